@@ -9,7 +9,11 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey = contextKey("user")
+	// connContextKey holds the connection a request arrived on, see the server's ConnContext.
+	connContextKey = contextKey("conn")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
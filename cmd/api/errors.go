@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
@@ -37,6 +38,11 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 	app.errorResponse(w, r, http.StatusBadRequest, msg)
 }
 
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	msg := fmt.Sprintf("the Content-Type must be one of: %s", strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, msg)
+}
+
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
@@ -46,6 +52,38 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// duplicateMovieResponse reports that the movie being created looks like a duplicate, linking to the existing movie.
+func (app *application) duplicateMovieResponse(w http.ResponseWriter, r *http.Request, existingID int64) {
+	message := "a movie with this title and year already exists, use ?allow_duplicate=true to create it anyway"
+	link := fmt.Sprintf("/v1/movies/%d", existingID)
+
+	headers := make(http.Header)
+	headers.Set("Location", link)
+
+	err := app.writeJSON(w, http.StatusConflict, envelope{"message": message, "existing_movie": link}, headers)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
+// externalIDConflictResponse reports that a deleted movie can't be restored as another movie has since been given one
+// of its external ids.
+func (app *application) externalIDConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "another movie now has one of this movie's external ids, remove it from one of them and try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been modified since the version given in If-Match, please fetch it and try again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this request must be made conditional with an If-Match header"
+	app.errorResponse(w, r, http.StatusPreconditionRequired, message)
+}
+
 // logError receives the request and raised error and uses the custom logger to
 // print the error and the request's details.
 func (app *application) logError(r *http.Request, err error) {
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"richwynmorris.co.uk/internal/data"
+	"richwynmorris.co.uk/internal/validator"
+)
+
+const (
+	// exportFlushInterval is the number of movies written between flushes of the response.
+	exportFlushInterval = 100
+	// exportIdleTimeout is how long an export may go without flushing before the connection is timed out. The
+	// deadline is pushed back on every flush, so an export which keeps making progress isn't cut off by the server's
+	// timeouts however large it is.
+	exportIdleTimeout = time.Minute
+)
+
+// exportMoviesHandler streams every movie matching the listing filters as CSV or NDJSON. Rows are written
+// to the client as they're read from the database, so unlike listMoviesHandler the response isn't paginated. The
+// runtime is written as "<n> mins", as in the JSON API, unless ?runtime_format=minutes asks for the bare number.
+//
+// As the status is sent before the rows, an export which fails partway through still has a 200 status. The
+// X-Export-Complete and X-Export-Count trailers tell the client whether every row was sent and how many there were;
+// an export without them was cut short.
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Criteria      data.MovieCriteria
+		Format        string
+		RuntimeFormat string
+	}
+
+	query := r.URL.Query()
+
+	v := validator.New()
+
+	input.Criteria = app.readMovieCriteria(query, v)
+	input.Format = app.readString(query, "format", "ndjson")
+	input.RuntimeFormat = app.readString(query, "runtime_format", "text")
+
+	data.ValidateMovieCriteria(v, input.Criteria)
+	v.Check(validator.PermittedValue(input.Format, "csv", "ndjson"), "format", "must be csv or ndjson")
+	v.Check(validator.PermittedValue(input.RuntimeFormat, "text", "minutes"), "runtime_format", "must be text or minutes")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var header, flush func() error
+	var write func(movie *data.Movie) error
+
+	switch input.Format {
+	case "csv":
+		cw := csv.NewWriter(w)
+
+		header = func() error {
+			return cw.Write([]string{"id", "title", "year", "runtime", "genres", "version", "average_rating", "rating_count"})
+		}
+		write = func(movie *data.Movie) error {
+			runtime := strconv.FormatInt(int64(movie.Runtime), 10)
+			if input.RuntimeFormat == "text" {
+				runtime += " mins"
+			}
+
+			return cw.Write([]string{
+				strconv.FormatInt(movie.ID, 10),
+				movie.Title,
+				strconv.FormatInt(int64(movie.Year), 10),
+				runtime,
+				strings.Join(movie.Genres, ","),
+				strconv.FormatInt(int64(movie.Version), 10),
+				strconv.FormatFloat(movie.AverageRating, 'f', -1, 64),
+				strconv.FormatInt(int64(movie.RatingCount), 10),
+			})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case "ndjson":
+		enc := json.NewEncoder(w)
+
+		header = func() error { return nil }
+		write = func(movie *data.Movie) error {
+			if input.RuntimeFormat == "text" {
+				return enc.Encode(movie)
+			}
+
+			// The outer Runtime field takes precedence over the embedded movie's when encoding.
+			return enc.Encode(struct {
+				*data.Movie
+				Runtime int32 `json:"runtime,omitempty"`
+			}{movie, int32(movie.Runtime)})
+		}
+		flush = func() error { return nil }
+	}
+
+	// The response is only started once the first movie has been read, so a failed query can still be reported
+	// with an error response.
+	started := false
+
+	start := func() error {
+		started = true
+		app.writeExportHeaders(w, input.Format)
+		return header()
+	}
+
+	written := 0
+
+	err := app.extendDeadlines(r, exportIdleTimeout)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Movies.Export(r.Context(), input.Criteria, func(movie *data.Movie) error {
+		if !started {
+			err := start()
+			if err != nil {
+				return err
+			}
+		}
+
+		err := write(movie)
+		if err != nil {
+			return err
+		}
+
+		written++
+
+		if written%exportFlushInterval == 0 {
+			err = flush()
+			if err != nil {
+				return err
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+
+			err = app.extendDeadlines(r, exportIdleTimeout)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		if !started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// The response is already under way, so all that can be done is to log the error and cut it short.
+		app.logError(r, err)
+	}
+
+	w.Header().Set("X-Export-Complete", strconv.FormatBool(err == nil))
+	w.Header().Set("X-Export-Count", strconv.Itoa(written))
+}
+
+func (app *application) writeExportHeaders(w http.ResponseWriter, format string) {
+	contentType := "application/x-ndjson"
+	if format == "csv" {
+		contentType = "text/csv"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="movies.`+format+`"`)
+	// Announce the trailers set once every row has been written, see exportMoviesHandler.
+	w.Header().Set("Trailer", "X-Export-Complete, X-Export-Count")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// The test server doesn't record connections the way serve does, so this also checks that an export isn't refused
+// when its deadlines can't be extended.
+func TestExportMoviesTrailers(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createMovie(t)
+
+	resp, body := ts.do(t, http.MethodGet, "/v1/movies/export?format=ndjson", nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.StatusCode, body)
+	}
+
+	if got := resp.Trailer.Get("X-Export-Complete"); got != "true" {
+		t.Errorf("got X-Export-Complete %q; want true", got)
+	}
+
+	count, err := strconv.Atoi(resp.Trailer.Get("X-Export-Count"))
+	if err != nil || count < 1 {
+		t.Errorf("got X-Export-Count %q; want at least 1", resp.Trailer.Get("X-Export-Count"))
+	}
+}
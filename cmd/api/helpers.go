@@ -5,13 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 
+	"richwynmorris.co.uk/internal/data"
 	"richwynmorris.co.uk/internal/validator"
 )
 
@@ -30,6 +34,18 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// readVersionParam reads the movie version from the request's route params.
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	version, err := strconv.ParseInt(params.ByName("version"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+
+	return int32(version), nil
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	js, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
@@ -38,8 +54,12 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 
 	js = append(js, '\n')
 
-	for key, value := range headers {
-		w.Header()[key] = value
+	// Headers are added rather than set, so values already on the response, such as the Vary set by the CORS
+	// middleware, are kept.
+	for key, values := range headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -134,6 +154,163 @@ func (app *application) readInts(qs url.Values, key string, defaultValue int, v
 	return i
 }
 
+// readInt32 reads an integer which must fit in an int32, such as one compared with an integer column. Larger values are
+// reported as errors rather than wrapping around.
+func (app *application) readInt32(qs url.Values, key string, defaultValue int32, v *validator.Validator) int32 {
+	i := app.readInts(qs, key, int(defaultValue), v)
+
+	if i < math.MinInt32 || i > math.MaxInt32 {
+		v.AddError(key, fmt.Sprintf("must be between %d and %d", math.MinInt32, math.MaxInt32))
+		return defaultValue
+	}
+
+	return int32(i)
+}
+
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readTime parses the query string value as an RFC 3339 timestamp or a plain date, which is taken to be midnight UTC.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", s)
+		if err != nil {
+			v.AddError(key, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+			return time.Time{}
+		}
+	}
+
+	return t
+}
+
+// readMovieCriteria reads the filters shared by the movie listing and export from the query string. genres_all is
+// accepted as a more explicit name for genres.
+func (app *application) readMovieCriteria(qs url.Values, v *validator.Validator) data.MovieCriteria {
+	return data.MovieCriteria{
+		Title:         app.readString(qs, "title", ""),
+		Genres:        app.readCSV(qs, "genres_all", app.readCSV(qs, "genres", []string{})),
+		GenresAny:     app.readCSV(qs, "genres_any", []string{}),
+		ExcludeGenres: app.readCSV(qs, "exclude_genres", []string{}),
+		YearMin:       app.readInt32(qs, "year_min", 0, v),
+		YearMax:       app.readInt32(qs, "year_max", 0, v),
+		RuntimeMin:    app.readInt32(qs, "runtime_min", 0, v),
+		RuntimeMax:    app.readInt32(qs, "runtime_max", 0, v),
+		CreatedAfter:  app.readTime(qs, "created_after", v),
+		CreatedBefore: app.readTime(qs, "created_before", v),
+	}
+}
+
+// hasPermission reports whether the user making the request has been granted the permission code.
+func (app *application) hasPermission(r *http.Request, code string) (bool, error) {
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.Include(code), nil
+}
+
+// requireAdmin checks the user making the request holds the movies:admin permission, for handlers which only expose
+// some of their options to admins. If they don't, a response is sent and false returned.
+func (app *application) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	ok, err := app.hasPermission(r, "movies:admin")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// movieETag returns the entity tag for a movie. It's derived from the movie's version, so it changes whenever the
+// movie does. A movie whose title has been localised is a different representation, so its tag also carries the
+// locale of the title.
+func movieETag(movie *data.Movie) string {
+	if movie.TitleLocale != "" {
+		return fmt.Sprintf(`"%d-%s"`, movie.Version, movie.TitleLocale)
+	}
+	return fmt.Sprintf(`"%d"`, movie.Version)
+}
+
+// versionETag strips the locale from an entity tag issued for a localised movie, leaving the tag for its version.
+func versionETag(tag string) string {
+	if i := strings.IndexByte(tag, '-'); i >= 0 && strings.HasSuffix(tag, `"`) {
+		return tag[:i] + `"`
+	}
+	return tag
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header value lists etag, or is the wildcard. With weak set
+// a W/ prefix on the listed tags is ignored, as If-None-Match requires.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkIfMatch enforces the If-Match precondition on a write to the movie. If the header is missing when the
+// application requires it, or doesn't match the movie's entity tag, a response is sent and false returned. Tags issued
+// for a localised representation match as long as they are for the movie's current version.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, movie *data.Movie) bool {
+	match := r.Header.Get("If-Match")
+
+	if match == "" {
+		if app.config.requireIfMatch {
+			app.preconditionRequiredResponse(w, r)
+			return false
+		}
+		return true
+	}
+
+	tags := strings.Split(match, ",")
+	for i, tag := range tags {
+		tags[i] = versionETag(strings.TrimSpace(tag))
+	}
+
+	if !etagMatches(strings.Join(tags, ","), movieETag(movie), false) {
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
 func (app *application) background(fn func()) {
 	// Increment the waitgroup to track the total number of current go routines.
 	app.wg.Add(1)
@@ -154,3 +331,24 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// extendDeadlines pushes the read and write deadlines of the request's connection back to d from now, for handlers
+// such as bulk imports and exports which legitimately outlast the server's timeouts. The read deadline matters even
+// once the body has been read, as the server cancels the request's context when it passes. If the request's
+// connection wasn't recorded, as when the handler is served by a server other than the one built in serve, there's
+// nothing to extend and the handler runs under that server's own timeouts.
+func (app *application) extendDeadlines(r *http.Request, d time.Duration) error {
+	conn, ok := r.Context().Value(connContextKey).(net.Conn)
+	if !ok {
+		return nil
+	}
+
+	deadline := time.Now().Add(d)
+
+	err := conn.SetReadDeadline(deadline)
+	if err != nil {
+		return err
+	}
+
+	return conn.SetWriteDeadline(deadline)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"richwynmorris.co.uk/internal/validator"
+)
+
+func TestExtendDeadlines(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		name        string
+		connContext func(ctx context.Context, c net.Conn) context.Context
+	}{
+		{"connection recorded", func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connContextKey, c)
+		}},
+		{"connection not recorded", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err := app.extendDeadlines(r, time.Minute)
+				if err != nil {
+					t.Errorf("got error %v", err)
+				}
+			}))
+			ts.Config.ConnContext = tt.connContext
+			ts.Start()
+			defer ts.Close()
+
+			resp, err := ts.Client().Get(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestReadInt32(t *testing.T) {
+	app := &application{}
+
+	tests := []struct {
+		value     string
+		want      int32
+		wantValid bool
+	}{
+		{"", 7, true},
+		{"2000", 2000, true},
+		{"-2147483648", -2147483648, true},
+		{"2147483647", 2147483647, true},
+		{"2147483648", 7, false},
+		{"4294969296", 7, false},
+		{"-2147483649", 7, false},
+		{"abc", 7, false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+
+		got := app.readInt32(url.Values{"year_min": {tt.value}}, "year_min", 7, v)
+
+		if got != tt.want || v.Valid() != tt.wantValid {
+			t.Errorf("readInt32(%q) = %d, valid %t; want %d, valid %t", tt.value, got, v.Valid(), tt.want, tt.wantValid)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"richwynmorris.co.uk/internal/data"
+	"richwynmorris.co.uk/internal/validator"
+)
+
+const (
+	// importBatchSize is the number of movies inserted in each transaction of an import.
+	importBatchSize = 500
+	// importTimeout bounds how long an import may take, from reading the body to writing the report. It replaces the
+	// server's much shorter timeouts, which a large atomic import written in a single transaction can outlast.
+	importTimeout = 5 * time.Minute
+)
+
+// importRow is a single movie read from an import, along with the line it was found on.
+type importRow struct {
+	line   int
+	movie  *data.Movie
+	errors map[string]string
+}
+
+type importResult struct {
+	Line       int               `json:"line"`
+	Status     string            `json:"status"`
+	ID         int64             `json:"id,omitempty"`
+	ExistingID int64             `json:"existing_movie_id,omitempty"`
+	Errors     map[string]string `json:"errors,omitempty"`
+}
+
+// importMoviesHandler creates movies in bulk from a CSV or NDJSON body, reporting the outcome of each line. Every row
+// is validated and checked for duplicates, as createMovieHandler does, before anything is written. With ?dry_run=true
+// nothing is written at all. With ?atomic=true the import is all or nothing, otherwise valid rows are created even if
+// others fail. ?allow_duplicate=true skips the duplicate check.
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	v := validator.New()
+
+	dryRun := app.readBool(query, "dry_run", false, v)
+	atomic := app.readBool(query, "atomic", false, v)
+	allowDuplicate := app.readBool(query, "allow_duplicate", false, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := app.extendDeadlines(r, importTimeout)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), importTimeout)
+	defer cancel()
+
+	maxBytes := 10 * 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var rows []importRow
+
+	switch mediaType {
+	case "text/csv":
+		rows, err = app.readMovieCSV(r.Body)
+	case "application/x-ndjson":
+		rows, err = app.readMovieNDJSON(r.Body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "text/csv", "application/x-ndjson")
+		return
+	}
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			err = fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	switch {
+	case len(rows) == 0:
+		app.badRequestResponse(w, r, errors.New("body must contain at least one movie"))
+		return
+	case len(rows) > app.config.imports.maxRows:
+		app.badRequestResponse(w, r, fmt.Errorf("body must not contain more than %d movies", app.config.imports.maxRows))
+		return
+	}
+
+	results := make([]importResult, len(rows))
+	var valid []int
+
+	for i, row := range rows {
+		results[i].Line = row.line
+
+		if row.errors == nil {
+			v := validator.New()
+			data.ValidateMovie(v, row.movie)
+			if !v.Valid() {
+				row.errors = v.Errors
+			}
+		}
+
+		if row.errors != nil {
+			results[i].Status = "invalid"
+			results[i].Errors = row.errors
+			continue
+		}
+
+		results[i].Status = "valid"
+		valid = append(valid, i)
+	}
+
+	if !allowDuplicate && len(valid) > 0 {
+		valid, err = app.checkImportDuplicates(ctx, rows, valid, results)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	status := http.StatusOK
+
+	switch {
+	case dryRun:
+	case atomic && len(valid) < len(rows):
+		status = http.StatusUnprocessableEntity
+	default:
+		user := app.contextGetUser(r)
+
+		// An atomic import must be written in a single transaction, so it isn't split into batches.
+		size := importBatchSize
+		if atomic {
+			size = len(valid)
+		}
+
+		for start := 0; start < len(valid); start += size {
+			end := start + size
+			if end > len(valid) {
+				end = len(valid)
+			}
+
+			batch := valid[start:end]
+			movies := make([]*data.Movie, len(batch))
+			for i, index := range batch {
+				movies[i] = rows[index].movie
+			}
+
+			failures, err := app.models.Movies.InsertMany(ctx, movies, user.ID, !atomic)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			for i, index := range batch {
+				if failures[i] != nil {
+					app.logError(r, failures[i])
+					results[index].Status = "failed"
+					results[index].Errors = map[string]string{"movie": "the movie could not be created"}
+					continue
+				}
+
+				results[index].Status = "created"
+				results[index].ID = movies[i].ID
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	summary := map[string]any{"dry_run": dryRun, "atomic": atomic, "total": len(rows)}
+	for status, count := range counts {
+		summary[status] = count
+	}
+
+	err = app.writeJSON(w, status, envelope{"import": summary, "results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkImportDuplicates marks the valid rows which duplicate a movie that already exists, or an earlier row of the
+// import, and returns the indexes of the rows which are still valid.
+func (app *application) checkImportDuplicates(ctx context.Context, rows []importRow, valid []int, results []importResult) ([]int, error) {
+	movies := make([]*data.Movie, len(valid))
+	for i, index := range valid {
+		movies[i] = rows[index].movie
+	}
+
+	existing, earlier, err := app.models.Movies.FindDuplicates(ctx, movies)
+	if err != nil {
+		return nil, err
+	}
+
+	var unique []int
+
+	for i, index := range valid {
+		switch {
+		case existing[i] != 0:
+			results[index].Status = "duplicate"
+			results[index].ExistingID = existing[i]
+			results[index].Errors = map[string]string{"movie": "a movie with this title and year already exists"}
+		case earlier[i] >= 0:
+			results[index].Status = "duplicate"
+			results[index].Errors = map[string]string{
+				"movie": fmt.Sprintf("duplicates the movie on line %d", rows[valid[earlier[i]]].line),
+			}
+		default:
+			unique = append(unique, index)
+		}
+	}
+
+	return unique, nil
+}
+
+// readMovieCSV reads movies from a CSV document. The first record must be a header naming the title, year, runtime
+// and genres columns, in any order. The runtime is given in minutes, optionally followed by "mins", and the genres
+// are comma separated within their field.
+func (app *application) readMovieCSV(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.PermittedValue(name, "title", "year", "runtime", "genres") {
+			return nil, fmt.Errorf("header contains unknown column %q", name)
+		}
+		columns[name] = i
+	}
+
+	for _, name := range []string{"title", "year", "runtime", "genres"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("header must contain a %q column", name)
+		}
+	}
+
+	var rows []importRow
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		// A record with the wrong number of fields is reported against its line, any other error means the document
+		// can't be read any further.
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) && errors.Is(err, csv.ErrFieldCount) {
+			rows = append(rows, importRow{line: parseError.StartLine, errors: map[string]string{"row": "wrong number of fields"}})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		row := importRow{line: line, movie: &data.Movie{Title: record[columns["title"]]}}
+		v := validator.New()
+
+		year, err := strconv.ParseInt(strings.TrimSpace(record[columns["year"]]), 10, 32)
+		v.Check(err == nil, "year", "year must be an integer")
+		row.movie.Year = int32(year)
+
+		runtime := strings.TrimSuffix(strings.TrimSpace(record[columns["runtime"]]), " mins")
+		mins, err := strconv.ParseInt(runtime, 10, 32)
+		v.Check(err == nil, "runtime", "runtime must be a number of minutes")
+		row.movie.Runtime = data.Runtime(mins)
+
+		row.movie.Genres = []string{}
+		for _, genre := range strings.Split(record[columns["genres"]], ",") {
+			if genre = strings.TrimSpace(genre); genre != "" {
+				row.movie.Genres = append(row.movie.Genres, genre)
+			}
+		}
+
+		if !v.Valid() {
+			row.errors = v.Errors
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// readMovieNDJSON reads movies from newline delimited JSON, with each line holding a movie in the same format accepted
+// by createMovieHandler. Blank lines are skipped.
+func (app *application) readMovieNDJSON(body io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1_048_576)
+
+	var rows []importRow
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var input struct {
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Genres  []string     `json:"genres"`
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&input)
+		if err != nil {
+			rows = append(rows, importRow{line: line, errors: map[string]string{"row": "line is not a valid movie JSON object"}})
+			continue
+		}
+
+		movie := &data.Movie{
+			Title:   input.Title,
+			Year:    input.Year,
+			Runtime: input.Runtime,
+			Genres:  input.Genres,
+		}
+
+		rows = append(rows, importRow{line: line, movie: movie})
+	}
+
+	return rows, scanner.Err()
+}
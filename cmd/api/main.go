@@ -14,6 +14,7 @@ import (
 
 	_ "github.com/lib/pq"
 
+	"richwynmorris.co.uk/internal/blobstore"
 	"richwynmorris.co.uk/internal/data"
 	"richwynmorris.co.uk/internal/jsonlog"
 	"richwynmorris.co.uk/internal/mailer"
@@ -27,9 +28,10 @@ var (
 
 // config is used to manage the configuration settings of the application.
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port           int
+	env            string
+	requireIfMatch bool
+	db             struct {
 		dsn         string
 		maxOpenConn int
 		maxIdleConn int
@@ -50,15 +52,45 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	imports struct {
+		maxRows int
+	}
+	batch struct {
+		maxIDs int
+	}
+	stats struct {
+		cacheTTL time.Duration
+	}
+	blobs struct {
+		backend     string
+		localDir    string
+		s3Endpoint  string
+		s3Region    string
+		s3Bucket    string
+		s3AccessKey string
+		s3SecretKey string
+	}
+	posters struct {
+		maxBytes int64
+	}
+	purge struct {
+		retention time.Duration
+		interval  time.Duration
+	}
 }
 
 // application holds the handlers, helpers and middleware to support the application's functionality.
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config     config
+	logger     *jsonlog.Logger
+	models     data.Models
+	mailer     mailer.Mailer
+	wg         sync.WaitGroup
+	statsCache statsCache
+	blobs      blobstore.Store
+	// shutdown is closed once the server has stopped accepting requests, telling background tasks which run for the
+	// life of the application to finish up.
+	shutdown chan struct{}
 }
 
 func main() {
@@ -92,6 +124,27 @@ func main() {
 		return nil
 	})
 
+	flag.IntVar(&cfg.imports.maxRows, "import-max-rows", 10_000, "Maximum number of movies in a single import")
+	flag.IntVar(&cfg.batch.maxIDs, "batch-max-ids", 100, "Maximum number of movies fetched in a single batch")
+	flag.DurationVar(&cfg.stats.cacheTTL, "stats-cache-ttl", time.Minute, "How long catalogue stats are cached for (0 disables caching)")
+
+	// Soft deleted movies are purged permanently once they are older than the retention period.
+	flag.DurationVar(&cfg.purge.retention, "purge-retention", 30*24*time.Hour, "Retention period for deleted movies")
+	flag.DurationVar(&cfg.purge.interval, "purge-interval", time.Hour, "Interval between purges of deleted movies (0 disables purging)")
+
+	// Blob storage for uploaded images, either a local directory or an S3 compatible bucket.
+	flag.StringVar(&cfg.blobs.backend, "blob-backend", "local", "Blob storage backend (local|s3)")
+	flag.StringVar(&cfg.blobs.localDir, "blob-local-dir", "./uploads", "Directory blobs are kept in by the local backend")
+	flag.StringVar(&cfg.blobs.s3Endpoint, "blob-s3-endpoint", "", "S3 compatible endpoint, e.g. http://localhost:9000")
+	flag.StringVar(&cfg.blobs.s3Region, "blob-s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&cfg.blobs.s3Bucket, "blob-s3-bucket", "", "S3 bucket")
+	flag.StringVar(&cfg.blobs.s3AccessKey, "blob-s3-access-key", os.Getenv("GREENLIGHT_S3_ACCESS_KEY"), "S3 access key")
+	flag.StringVar(&cfg.blobs.s3SecretKey, "blob-s3-secret-key", os.Getenv("GREENLIGHT_S3_SECRET_KEY"), "S3 secret key")
+
+	flag.Int64Var(&cfg.posters.maxBytes, "poster-max-bytes", 5*1024*1024, "Maximum size of an uploaded poster")
+
+	flag.BoolVar(&cfg.requireIfMatch, "require-if-match", false, "Require an If-Match header on movie updates and deletes")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	// Parses the flag values and sets them to the config fields.
@@ -116,6 +169,11 @@ func main() {
 
 	logger.PrintInfo("database connection pool established", nil)
 
+	blobs, err := openBlobStore(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	// Set Metric Variables:
 	// Version
 	expvar.NewString("version").Set(version)
@@ -144,6 +202,12 @@ func main() {
 			cfg.smtp.password,
 			cfg.smtp.sender,
 		),
+		blobs:    blobs,
+		shutdown: make(chan struct{}),
+	}
+
+	if cfg.purge.interval > 0 {
+		app.background(app.purgeDeletedMovies)
 	}
 
 	err = app.serve()
@@ -153,6 +217,18 @@ func main() {
 
 }
 
+// openBlobStore returns the blob store chosen by the blob-backend flag.
+func openBlobStore(cfg config) (blobstore.Store, error) {
+	switch cfg.blobs.backend {
+	case "local":
+		return blobstore.NewLocal(cfg.blobs.localDir)
+	case "s3":
+		return blobstore.NewS3(cfg.blobs.s3Endpoint, cfg.blobs.s3Region, cfg.blobs.s3Bucket, cfg.blobs.s3AccessKey, cfg.blobs.s3SecretKey)
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", cfg.blobs.backend)
+	}
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	// Create an empty connection pool using the dsn config.
 	db, err := sql.Open("postgres", cfg.db.dsn)
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"richwynmorris.co.uk/internal/data"
 	"richwynmorris.co.uk/internal/validator"
@@ -11,10 +15,11 @@ import (
 
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
+		Title       string           `json:"title"`
+		Year        int32            `json:"year"`
+		Runtime     data.Runtime     `json:"runtime"`
+		Genres      []string         `json:"genres"`
+		ExternalIDs data.ExternalIDs `json:"external_ids"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -24,27 +29,48 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:       input.Title,
+		Year:        input.Year,
+		Runtime:     input.Runtime,
+		Genres:      input.Genres,
+		ExternalIDs: input.ExternalIDs,
 	}
 
 	v := validator.New()
+	allowDuplicate := app.readBool(r.URL.Query(), "allow_duplicate", false, v)
 	data.ValidateMovie(v, movie)
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	if !allowDuplicate {
+		existing, err := app.models.Movies.FindDuplicate(movie.Title, movie.Year)
+		switch {
+		case err == nil:
+			app.duplicateMovieResponse(w, r, existing.ID)
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "another movie already has one of these external ids")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%v", movie.ID))
+	headers.Set("ETag", movieETag(movie))
 
 	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
 	if err != nil {
@@ -60,17 +86,62 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	v := validator.New()
+
+	includeDeleted := app.readBool(r.URL.Query(), "include_deleted", false, v)
+	fields, include := app.readMovieShape(r.URL.Query(), v)
+	locales := app.readLocales(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if includeDeleted && !app.requireAdmin(w, r) {
+		return
+	}
+
+	movie, err := app.models.Movies.GetFields(id, fields, includeDeleted)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.resourceNotFoundResponse(w, r)
+			app.redirectMergedMovie(w, r, id)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
+		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	// The movie is localised first, as the entity tag depends on which locale its title was resolved to.
+	err = app.localiseMovies([]*data.Movie{movie}, locales)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+	headers.Set("Vary", "Accept-Language")
+
+	// The client already holds this version of the movie, so there's no need to send it again.
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, movieETag(movie), true) {
+		w.Header().Set("ETag", movieETag(movie))
+		w.Header().Add("Vary", "Accept-Language")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var body any = movie
+
+	if len(fields) > 0 || len(include) > 0 {
+		shaped, err := app.shapeMovies([]*data.Movie{movie}, fields, include)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		body = shaped[0]
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": body}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -96,11 +167,17 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if !app.checkIfMatch(w, r, movie) {
+		return
+	}
+
 	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
+		Title       *string           `json:"title"`
+		Year        *int32            `json:"year"`
+		Runtime     *data.Runtime     `json:"runtime"`
+		Genres      []string          `json:"genres"`
+		ExternalIDs map[string]string `json:"external_ids"`
+		Version     *int32            `json:"version"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -109,6 +186,12 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// A version in the body is the one the client last saw, so it must still be the current one.
+	if input.Version != nil && *input.Version != movie.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
 	if input.Title != nil {
 		movie.Title = *input.Title
 	}
@@ -125,6 +208,19 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		movie.Genres = input.Genres
 	}
 
+	// External ids are patched one provider at a time, and an empty id removes the provider's.
+	for provider, externalID := range input.ExternalIDs {
+		if movie.ExternalIDs == nil {
+			movie.ExternalIDs = data.ExternalIDs{}
+		}
+
+		if externalID == "" {
+			delete(movie.ExternalIDs, provider)
+		} else {
+			movie.ExternalIDs[provider] = externalID
+		}
+	}
+
 	v := validator.New()
 
 	data.ValidateMovie(v, movie)
@@ -133,18 +229,26 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "another movie already has one of these external ids")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -157,9 +261,39 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	// When the client names the version it means to delete, check it against the current one before deleting, and
+	// have the delete itself fail if the movie changes in between.
+	var version int32
+
+	if r.Header.Get("If-Match") != "" || app.config.requireIfMatch {
+		movie, err := app.models.Movies.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.resourceNotFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !app.checkIfMatch(w, r, movie) {
+			return
+		}
+
+		version = movie.Version
+	}
+
+	err = app.models.Movies.Delete(id, version, app.contextGetUser(r).ID)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -169,24 +303,95 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// restoreMovieHandler brings back a movie that has been soft deleted.
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.resourceNotFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			app.externalIDConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title   string
-		Genres  []string
-		Filters data.Filters
+		Criteria data.MovieCriteria
+		Filters  data.Filters
+		Facets   []string
+		Fields   []string
+		Include  []string
+		Locales  []string
 	}
 
 	query := r.URL.Query()
 
+	// ?ids= asks for specific movies rather than a listing.
+	if query.Has("ids") {
+		app.batchGetMovies(w, r, strings.Split(query.Get("ids"), ","))
+		return
+	}
+
 	v := validator.New()
 
-	input.Title = app.readString(query, "title", "")
-	input.Genres = app.readCSV(query, "genres", []string{})
+	input.Criteria = app.readMovieCriteria(query, v)
+	input.Criteria.Search = app.readString(query, "search", "")
+	input.Criteria.PersonID = int64(app.readInts(query, "person", 0, v))
+	input.Criteria.CollectionID = int64(app.readInts(query, "collection", 0, v))
+	input.Criteria.IncludeDeleted = app.readBool(query, "include_deleted", false, v)
+	input.Facets = app.readCSV(query, "facets", []string{})
+	input.Fields, input.Include = app.readMovieShape(query, v)
+	input.Locales = app.readLocales(r, v)
 	input.Filters.Page = app.readInts(query, "page", 1, v)
 	input.Filters.PageSize = app.readInts(query, "page_size", 20, v)
-	input.Filters.Sort = app.readString(query, "sort", "id")
-	input.Filters.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
 
+	// Searches are ranked best match first unless another sort is asked for.
+	defaultSort := "id"
+	if input.Criteria.Search != "" {
+		defaultSort = "-relevance"
+	}
+
+	input.Filters.Sort = app.readString(query, "sort", defaultSort)
+	input.Filters.SortSafeList = []string{
+		"id", "title", "year", "runtime", "average_rating", "rating_count",
+		"-id", "-title", "-year", "-runtime", "-average_rating", "-rating_count", "-relevance",
+	}
+
+	// A cursor switches the listing from page numbers to keyset pagination.
+	if cursor := app.readString(query, "cursor", ""); cursor != "" {
+		c, err := data.DecodeCursor(cursor)
+		if err != nil {
+			v.AddError("cursor", "invalid cursor")
+		}
+		input.Filters.Cursor = c
+	}
+
+	v.Check(input.Criteria.PersonID >= 0, "person", "must be a valid person id")
+	v.Check(input.Criteria.CollectionID >= 0, "collection", "must be a valid collection id")
+	for _, facet := range input.Facets {
+		v.Check(validator.PermittedValue(facet, data.FacetNames...), "facets", "invalid facet: "+facet)
+	}
+	v.Check(validator.Unique(input.Facets), "facets", "must not contain duplicates")
+	v.Check(len(input.Criteria.Search) <= 500, "search", "must not be more than 500 bytes long")
+	v.Check(input.Filters.Sort != "-relevance" || input.Criteria.Search != "", "sort", "relevance sort requires a search")
+
+	data.ValidateMovieCriteria(v, input.Criteria)
 	data.ValidateFilters(v, input.Filters)
 
 	if !v.Valid() {
@@ -194,15 +399,317 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	if input.Criteria.IncludeDeleted && !app.requireAdmin(w, r) {
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAll(input.Criteria, input.Filters, input.Fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.localiseMovies(movies, input.Locales)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"movies": movies, "metadata": metadata}
+
+	if len(input.Fields) > 0 || len(input.Include) > 0 {
+		env["movies"], err = app.shapeMovies(movies, input.Fields, input.Include)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Facets are opt in, as counting them costs a query per facet on top of the listing.
+	if len(input.Facets) > 0 {
+		facets, err := app.models.Movies.Facets(input.Criteria, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["facets"] = facets
+	}
+
+	headers := make(http.Header)
+	headers.Set("Vary", "Accept-Language")
+
+	err = app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+}
+
+// mergeMovieHandler folds the movie into the one given by "into" in the request body, for when the same movie has been
+// added twice. Requests for the merged movie's id are redirected to the movie it was merged into from then on.
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.resourceNotFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Into int64 `json:"into"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Into > 0, "into", "must be provided")
+	v.Check(input.Into != id, "into", "a movie cannot be merged into itself")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, poster, err := app.models.Movies.Merge(id, input.Into, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if poster != nil {
+		app.deletePosterBlobs(poster)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%v", movie.ID))
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redirectMergedMovie responds to a request for a movie which couldn't be found. If the movie was merged into another
+// the client is redirected to it, otherwise the response is a 404.
+func (app *application) redirectMergedMovie(w http.ResponseWriter, r *http.Request, id int64) {
+	movieID, err := app.models.Movies.GetRedirect(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	location := fmt.Sprintf("/v1/movies/%d", movieID)
+
+	headers := make(http.Header)
+	headers.Set("Location", location)
+
+	env := envelope{"message": "this movie has been merged into another", "movie": location}
+
+	err = app.writeJSON(w, http.StatusMovedPermanently, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// lookupMovieHandler resolves an external id, given as ?imdb=, ?tmdb= or ?eidr=, to the movie holding it. The movie is
+// localised and tagged the same way as by showMovieHandler, so both agree on its representation.
+func (app *application) lookupMovieHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var provider, externalID string
+
+	v := validator.New()
+
+	for _, p := range data.ExternalIDProviders {
+		if query.Has(p) {
+			v.Check(provider == "", "lookup", "only one external id can be looked up at a time")
+			provider, externalID = p, query.Get(p)
+		}
+	}
+
+	v.Check(provider != "", "lookup", "an imdb, tmdb or eidr id must be provided")
+	if v.Valid() {
+		data.ValidateExternalID(v, provider, externalID)
+	}
+
+	locales := app.readLocales(r, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+
+	movie, err := app.models.Movies.GetByExternalID(provider, externalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.localiseMovies([]*data.Movie{movie}, locales)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Location", fmt.Sprintf("/v1/movies/%v", movie.ID))
+	headers.Set("ETag", movieETag(movie))
+	headers.Set("Vary", "Accept-Language")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, movieETag(movie), true) {
+		w.Header().Set("ETag", movieETag(movie))
+		w.Header().Add("Vary", "Accept-Language")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// batchGetMoviesHandler fetches the movies whose ids are given in the request body, as an alternative to ?ids= for
+// lists too long for a query string.
+func (app *application) batchGetMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ids := make([]string, len(input.IDs))
+	for i, id := range input.IDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+
+	app.batchGetMovies(w, r, ids)
+}
+
+// batchGetMovies responds with the movies with the given ids, in the order they were asked for, along with the ids
+// of any which couldn't be found. As with showMovieHandler, the id of a movie merged into another gets the movie it
+// was merged into; redirects maps each such id to the movie returned for it.
+func (app *application) batchGetMovies(w http.ResponseWriter, r *http.Request, rawIDs []string) {
+	v := validator.New()
+
+	ids := make([]int64, 0, len(rawIDs))
+
+	for _, raw := range rawIDs {
+		id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil || id < 1 {
+			v.AddError("ids", "must only contain positive integer ids")
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	v.Check(len(ids) > 0, "ids", "must contain at least one id")
+	v.Check(len(ids) <= app.config.batch.maxIDs, "ids", fmt.Sprintf("must not contain more than %d ids", app.config.batch.maxIDs))
+	v.Check(validator.Unique(ids), "ids", "must not contain duplicates")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, redirects, missing, err := app.models.Movies.GetMany(ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "redirects": redirects, "missing": missing}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ================================ SPARSE FIELDSETS ===============================================
+
+// movieIncludes lists the related resources which can be embedded in movie responses.
+var movieIncludes = []string{"credits"}
+
+// readMovieShape reads the sparse fieldset asked for with ?fields= and the related resources asked for with
+// ?include=, checking both against their safelists.
+func (app *application) readMovieShape(qs url.Values, v *validator.Validator) (fields, include []string) {
+	fields = app.readCSV(qs, "fields", []string{})
+	include = app.readCSV(qs, "include", []string{})
+
+	for _, field := range fields {
+		v.Check(validator.PermittedValue(field, data.MovieFields...), "fields", "invalid field: "+field)
+	}
+
+	for _, name := range include {
+		v.Check(validator.PermittedValue(name, movieIncludes...), "include", "invalid include: "+name)
+	}
+
+	return fields, include
+}
+
+// shapeMovies renders each movie as an object holding only the fields named, or all of them if none are, with the
+// related resources named in include embedded alongside. Fields keep their usual JSON encoding.
+func (app *application) shapeMovies(movies []*data.Movie, fields, include []string) ([]map[string]any, error) {
+	shaped := make([]map[string]any, len(movies))
+
+	for i, movie := range movies {
+		js, err := json.Marshal(movie)
+		if err != nil {
+			return nil, err
+		}
+
+		var all map[string]json.RawMessage
+
+		err = json.Unmarshal(js, &all)
+		if err != nil {
+			return nil, err
+		}
+
+		shaped[i] = make(map[string]any)
+
+		for name, value := range all {
+			if len(fields) == 0 || validator.PermittedValue(name, fields...) {
+				shaped[i][name] = value
+			}
+		}
+	}
+
+	if validator.PermittedValue("credits", include...) && len(movies) > 0 {
+		ids := make([]int64, len(movies))
+		for i, movie := range movies {
+			ids[i] = movie.ID
+		}
+
+		credits, err := app.models.Credits.GetAllForMovies(ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, movie := range movies {
+			shaped[i]["credits"] = append([]data.Credit{}, credits[movie.ID]...)
+		}
+	}
+
+	return shaped, nil
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"richwynmorris.co.uk/internal/data"
+	"richwynmorris.co.uk/internal/jsonlog"
+)
+
+// testServer is the API running against the database given by GREENLIGHT_TEST_DB_DSN, which must have had the
+// migrations applied. token authenticates as a user holding the movie and review permissions.
+type testServer struct {
+	*httptest.Server
+	db    *sql.DB
+	token string
+}
+
+// The application and its routes are shared by every test, as the metrics middleware can only be set up once per
+// process.
+var (
+	testSetup   sync.Once
+	testApp     *application
+	testHandler http.Handler
+	testDB      *sql.DB
+	testErr     error
+)
+
+// newTestServer starts the API for a test, skipping the test if no test database has been configured.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("GREENLIGHT_TEST_DB_DSN is not set")
+	}
+
+	testSetup.Do(func() {
+		testDB, testErr = sql.Open("postgres", dsn)
+		if testErr != nil {
+			return
+		}
+
+		testApp = &application{
+			logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+			models: data.NewModels(testDB),
+		}
+		testHandler = testApp.routes()
+	})
+	if testErr != nil {
+		t.Fatal(testErr)
+	}
+
+	app, db := testApp, testDB
+
+	user := &data.User{
+		Name:      "Test User",
+		Email:     fmt.Sprintf("test-%d@example.com", time.Now().UnixNano()),
+		Activated: true,
+	}
+
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.models.Users.Delete(user.ID) })
+
+	err = app.models.Permissions.AddForUser(user.ID, "movies:read", "movies:write", "reviews:write")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := app.models.Tokens.New(user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &testServer{Server: httptest.NewServer(testHandler), db: db, token: token.Plaintext}
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// do sends an authenticated request with body encoded as JSON, if it isn't nil, and returns the response with its
+// body read.
+func (ts *testServer) do(t *testing.T, method, path string, body any, headers map[string]string) (*http.Response, []byte) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+ts.token)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, respBody
+}
+
+// createMovie creates a movie for a test, removing it again when the test finishes.
+func (ts *testServer) createMovie(t *testing.T) int64 {
+	t.Helper()
+
+	movie := map[string]any{
+		"title":   fmt.Sprintf("Test Movie %d", time.Now().UnixNano()),
+		"year":    2001,
+		"runtime": "102 mins",
+		"genres":  []string{"drama"},
+	}
+
+	resp, body := ts.do(t, http.MethodPost, "/v1/movies", movie, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating movie: got status %d: %s", resp.StatusCode, body)
+	}
+
+	var created struct {
+		Movie struct {
+			ID int64 `json:"id"`
+		} `json:"movie"`
+	}
+
+	err := json.Unmarshal(body, &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { ts.db.Exec(`DELETE FROM movies WHERE id = $1`, created.Movie.ID) })
+
+	return created.Movie.ID
+}
+
+func TestShowMovieETagChangesWithReviews(t *testing.T) {
+	ts := newTestServer(t)
+
+	path := fmt.Sprintf("/v1/movies/%d", ts.createMovie(t))
+
+	resp, body := ts.do(t, http.MethodGet, path, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.StatusCode, body)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+
+	resp, _ = ts.do(t, http.MethodGet, path, nil, map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("unchanged movie: got status %d; want %d", resp.StatusCode, http.StatusNotModified)
+	}
+
+	resp, body = ts.do(t, http.MethodPost, path+"/reviews", map[string]any{"score": 8}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating review: got status %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = ts.do(t, http.MethodGet, path, nil, map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("reviewed movie: got status %d; want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	if resp.Header.Get("ETag") == etag {
+		t.Errorf("ETag %s didn't change after the movie was reviewed", etag)
+	}
+
+	var shown struct {
+		Movie struct {
+			RatingCount int `json:"rating_count"`
+		} `json:"movie"`
+	}
+
+	err := json.Unmarshal(body, &shown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shown.Movie.RatingCount != 1 {
+		t.Errorf("got rating_count %d; want 1", shown.Movie.RatingCount)
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	// Register the decoders for the formats posters can be uploaded in.
+	_ "image/gif"
+	_ "image/png"
+
+	"richwynmorris.co.uk/internal/blobstore"
+	"richwynmorris.co.uk/internal/data"
+	"richwynmorris.co.uk/internal/validator"
+)
+
+const (
+	// posterMaxPixels bounds the size of an uploaded image once decoded, so a small but highly compressed upload
+	// can't exhaust memory.
+	posterMaxPixels = 40_000_000
+	// thumbnailWidth is the width posters are scaled down to for thumbnails.
+	thumbnailWidth = 200
+)
+
+// posterExtensions maps the content types posters can be uploaded as to the extension they're stored with.
+var posterExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// uploadPosterHandler sets the movie's poster. The image can be sent as the body of the request, with its image
+// content type, or as the "poster" file of a multipart form. A JPEG thumbnail is generated alongside it.
+func (app *application) uploadPosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.resourceNotFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	upload, ok := app.readPosterUpload(w, r)
+	if !ok {
+		return
+	}
+
+	contentType := http.DetectContentType(upload)
+
+	v := validator.New()
+	v.Check(posterExtensions[contentType] != "", "poster", "must be a JPEG, PNG or GIF image")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(upload))
+	if err == nil && config.Width*config.Height > posterMaxPixels {
+		v.AddError("poster", fmt.Sprintf("must not be more than %d pixels", posterMaxPixels))
+	}
+
+	var img image.Image
+	if err == nil && v.Valid() {
+		img, _, err = image.Decode(bytes.NewReader(upload))
+	}
+	if err != nil {
+		v.AddError("poster", "must be a valid image")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	thumbnail := new(bytes.Buffer)
+
+	err = jpeg.Encode(thumbnail, scaleToWidth(img, thumbnailWidth), &jpeg.Options{Quality: 85})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Each upload is stored under new keys, so clients holding the old poster's ETag see that it changed.
+	token, err := randomHex(8)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	poster := &data.Poster{
+		MovieID:      movie.ID,
+		Key:          fmt.Sprintf("posters/%d/%s%s", movie.ID, token, posterExtensions[contentType]),
+		ContentType:  contentType,
+		ThumbnailKey: fmt.Sprintf("posters/%d/%s-thumbnail.jpg", movie.ID, token),
+		Width:        config.Width,
+		Height:       config.Height,
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	err = app.blobs.Put(ctx, poster.Key, bytes.NewReader(upload), int64(len(upload)), contentType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.blobs.Put(ctx, poster.ThumbnailKey, thumbnail, int64(thumbnail.Len()), "image/jpeg")
+	if err != nil {
+		app.deletePosterBlobs(poster)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	movie.PosterURL = fmt.Sprintf("/v1/movies/%d/poster", movie.ID)
+
+	previous, err := app.models.Posters.Set(poster, movie)
+	if err != nil {
+		app.deletePosterBlobs(poster)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if previous != nil {
+		app.deletePosterBlobs(previous)
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showPosterHandler serves the movie's poster, or its thumbnail if ?size=thumbnail is given.
+func (app *application) showPosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.resourceNotFoundResponse(w, r)
+		return
+	}
+
+	size := app.readString(r.URL.Query(), "size", "original")
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(size, "original", "thumbnail"), "size", "must be original or thumbnail")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	poster, err := app.models.Posters.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	key, contentType := poster.Key, poster.ContentType
+	if size == "thumbnail" {
+		key, contentType = poster.ThumbnailKey, "image/jpeg"
+	}
+
+	// Keys are never reused, so the key identifies the image's content.
+	etag := `"` + key + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	blob, err := app.blobs.Get(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blobstore.ErrNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+
+	_, err = io.Copy(w, blob)
+	if err != nil {
+		// The response has started, so all that can be done is to record the failure.
+		app.logError(r, err)
+	}
+}
+
+// readPosterUpload reads the image uploaded in the request body, either directly or as the "poster" file of a
+// multipart form. If it can't be read, a response is sent and false returned.
+func (app *application) readPosterUpload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	maxBytes := app.config.posters.maxBytes
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var body io.Reader
+
+	switch {
+	case mediaType == "multipart/form-data":
+		// Allow a little more than the image itself for the rest of the form.
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64*1024)
+
+		mr, err := r.MultipartReader()
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return nil, false
+		}
+
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				v := validator.New()
+				v.AddError("poster", "must be provided")
+				app.failedValidationResponse(w, r, v.Errors)
+				return nil, false
+			}
+			if err != nil {
+				app.badRequestResponse(w, r, app.posterReadError(err, maxBytes))
+				return nil, false
+			}
+
+			if part.FormName() == "poster" {
+				body = part
+				break
+			}
+		}
+	case strings.HasPrefix(mediaType, "image/"):
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		body = r.Body
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "multipart/form-data", "image/jpeg", "image/png", "image/gif")
+		return nil, false
+	}
+
+	// Read one byte more than allowed, so an oversized image in a multipart form is caught too.
+	upload, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err == nil && int64(len(upload)) > maxBytes {
+		err = errors.New("http: request body too large")
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, app.posterReadError(err, maxBytes))
+		return nil, false
+	}
+
+	if len(upload) == 0 {
+		v := validator.New()
+		v.AddError("poster", "must not be empty")
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// posterReadError turns the error from reading an upload into one that can be shown to the client.
+func (app *application) posterReadError(err error, maxBytes int64) error {
+	if err.Error() == "http: request body too large" {
+		return fmt.Errorf("poster must not be larger than %d bytes", maxBytes)
+	}
+	return err
+}
+
+// deletePosterBlobs removes the poster's images from the blob store in the background. Failures are logged rather
+// than returned, as they only leave unused images behind.
+func (app *application) deletePosterBlobs(poster *data.Poster) {
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		for _, key := range []string{poster.Key, poster.ThumbnailKey} {
+			err := app.blobs.Delete(ctx, key)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"key": key})
+			}
+		}
+	})
+}
+
+// scaleToWidth returns the image scaled down to the width, keeping its aspect ratio. Each pixel of the result is the
+// average of the block of pixels it covers in the original. Images no wider than width are copied as they are.
+func scaleToWidth(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+
+	if bounds.Dx() < width {
+		width = bounds.Dx()
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+
+			var r, g, b, a, n uint64
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// purgeDeletedMovies runs until the application shuts down, permanently removing movies which have been soft deleted
+// for longer than the configured retention period. It should be started with app.background, so that shutdown waits
+// for a purge which is under way to finish.
+func (app *application) purgeDeletedMovies() {
+	ticker := time.NewTicker(app.config.purge.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.shutdown:
+			return
+		case <-ticker.C:
+		}
+
+		purged, posters, err := app.models.Movies.Purge(time.Now().Add(-app.config.purge.retention))
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			continue
+		}
+
+		for _, poster := range posters {
+			app.deletePosterBlobs(poster)
+		}
+
+		if purged > 0 {
+			app.logger.PrintInfo("purged deleted movies", map[string]string{
+				"count": strconv.FormatInt(purged, 10),
+			})
+		}
+	}
+}
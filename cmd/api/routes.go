@@ -25,21 +25,101 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermissions("movies:write", app.deleteMovieHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermissions("movies:read", app.listMoviesHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermissions("movies:read", app.showMovieHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermissions("movies:write", app.updateMovieHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermissions("movies:write", app.createMovieHandler))
 
+	// Fixed paths beneath /v1/movies are dispatched from the :id route, see movieSubroutes.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.movieSubroutes(map[string]http.HandlerFunc{
+		"export": app.requirePermissions("movies:read", app.exportMoviesHandler),
+		"lookup": app.requirePermissions("movies:read", app.lookupMovieHandler),
+		"stats":  app.requirePermissions("movies:read", app.movieStatsHandler),
+	}, app.requirePermissions("movies:read", app.showMovieHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.movieSubroutes(map[string]http.HandlerFunc{
+		"batch-get": app.requirePermissions("movies:read", app.batchGetMoviesHandler),
+		"import":    app.requirePermissions("movies:write", app.importMoviesHandler),
+	}, app.methodNotAllowedResponse))
+
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermissions("movies:write", app.restoreMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/poster", app.requirePermissions("movies:read", app.showPosterHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/poster", app.requirePermissions("movies:write", app.uploadPosterHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/merge", app.requirePermissions("movies:admin", app.mergeMovieHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/similar", app.requirePermissions("movies:read", app.listSimilarMoviesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requirePermissions("movies:read", app.listMovieRevisionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version", app.requirePermissions("movies:read", app.showMovieRevisionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:version/restore", app.requirePermissions("movies:write", app.restoreMovieRevisionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.requirePermissions("movies:read", app.listMovieCreditsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/credits", app.requirePermissions("movies:write", app.replaceMovieCreditsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/titles", app.requirePermissions("movies:read", app.listMovieTitlesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/titles", app.requirePermissions("movies:write", app.replaceMovieTitlesHandler))
+
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews", app.requirePermissions("reviews:write", app.deleteReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.requirePermissions("movies:read", app.listReviewsHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/reviews", app.requirePermissions("reviews:write", app.updateReviewHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requirePermissions("reviews:write", app.createReviewHandler))
+
+	//================================== PEOPLE ======================================================
+
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermissions("movies:write", app.deletePersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requirePermissions("movies:read", app.listPeopleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requirePermissions("movies:read", app.showPersonHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermissions("movies:write", app.updatePersonHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermissions("movies:write", app.createPersonHandler))
+
+	//================================== COLLECTIONS =================================================
+
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id", app.requirePermissions("collections:write", app.deleteCollectionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/collections", app.requirePermissions("movies:read", app.listCollectionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/collections/:id", app.requirePermissions("movies:read", app.showCollectionHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/collections/:id", app.requirePermissions("collections:write", app.updateCollectionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/collections", app.requirePermissions("collections:write", app.createCollectionHandler))
+
 	//================================== USERS =======================================================
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireAuthenticatedUser(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthenticatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireAuthenticatedUser(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/email", app.requireActivatedUser(app.requestEmailChangeHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watchlist", app.requireActivatedUser(app.listWatchlistHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/watchlist", app.requireActivatedUser(app.addToWatchlistHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlist/:id", app.requireActivatedUser(app.removeFromWatchlistHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/watchlist/:id/watched", app.requireActivatedUser(app.markWatchedHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlist/:id/watched", app.requireActivatedUser(app.unmarkWatchedHandler))
 
 	// ================================ AUTHENTICATION ===============================================
 
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
 
 	// =============================== MIDDLEWARE ===================================================
 
 	// Panic Recovery; Enable Cors; Rate Limiting; Authentication.
 	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authentication(router)))))
 }
+
+// movieSubroutes returns a handler for a /v1/movies/:id route which serves the fixed paths in subroutes, keyed by the
+// value of the :id segment, and passes every other request on to next. httprouter won't register a static segment in
+// the same position as a wildcard, so endpoints such as /v1/movies/import have to be reached this way.
+func (app *application) movieSubroutes(subroutes map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := subroutes[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -21,6 +22,11 @@ func (app *application) serve() error {
 		WriteTimeout:      30 * time.Second,
 		IdleTimeout:       time.Minute,
 		ErrorLog:          log.New(app.logger, "", 0),
+		// Keep hold of each request's connection, so the few handlers which outlast the timeouts above can extend
+		// them with extendDeadlines.
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connContextKey, c)
+		},
 	}
 
 	shutdownErr := make(chan error)
@@ -51,6 +57,9 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		// Stop the background tasks which run for the life of the application, such as the purge of deleted movies.
+		close(app.shutdown)
+
 		// Wait for all background go routines to complete, once done, send a nil to the channel to indicate that
 		// the shutdown of the go routines was a success.
 		app.wg.Wait()
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"richwynmorris.co.uk/internal/data"
+	"richwynmorris.co.uk/internal/validator"
+)
+
+// listSimilarMoviesHandler recommends movies like the one given, most similar first. Each recommendation explains
+// which signals it matched on.
+func (app *application) listSimilarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.resourceNotFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Filters data.Filters
+		Locales []string
+	}
+
+	query := r.URL.Query()
+
+	v := validator.New()
+
+	input.Locales = app.readLocales(r, v)
+	input.Filters.Page = app.readInts(query, "page", 1, v)
+	input.Filters.PageSize = app.readInts(query, "page_size", 20, v)
+	input.Filters.Sort = app.readString(query, "sort", "-similarity")
+	input.Filters.SortSafeList = []string{"-similarity", "title", "year", "-title", "-year"}
+
+	data.ValidateFilters(v, input.Filters)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	similar, metadata, err := app.models.Movies.Similar(movie, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	movies := make([]*data.Movie, len(similar))
+	for i, item := range similar {
+		movies[i] = item.Movie
+	}
+
+	err = app.localiseMovies(movies, input.Locales)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Vary", "Accept-Language")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"similar": similar, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
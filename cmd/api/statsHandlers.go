@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"richwynmorris.co.uk/internal/data"
+)
+
+// statsCache holds the most recently computed catalogue stats, so that dashboards polling them don't each run the
+// aggregate queries.
+type statsCache struct {
+	mu      sync.Mutex
+	stats   *data.MovieStats
+	expires time.Time
+}
+
+// movieStatsHandler returns the catalogue stats, computing them afresh once the cached copy is older than the
+// configured TTL. A TTL of zero disables the cache.
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	cache := &app.statsCache
+
+	// Holding the lock while the stats are computed means concurrent requests wait for one computation rather than
+	// all running their own.
+	cache.mu.Lock()
+
+	if cache.stats == nil || !time.Now().Before(cache.expires) {
+		stats, err := app.models.Movies.Stats()
+		if err != nil {
+			cache.mu.Unlock()
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		cache.stats = stats
+		cache.expires = stats.GeneratedAt.Add(app.config.stats.cacheTTL)
+	}
+
+	stats := cache.stats
+	cache.mu.Unlock()
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"richwynmorris.co.uk/internal/data"
+	"richwynmorris.co.uk/internal/validator"
+)
+
+func (app *application) listMovieTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.resourceNotFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	titles, err := app.models.Titles.GetAllForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"titles": titles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// replaceMovieTitlesHandler sets the full list of a movie's localised titles, replacing any it already has.
+func (app *application) replaceMovieTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.resourceNotFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Titles []data.MovieTitle `json:"titles"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateMovieTitles(v, input.Titles)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Titles.ReplaceForMovie(id, input.Titles)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	titles, err := app.models.Titles.GetAllForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"titles": titles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readLocales returns the locales the client would like titles in, most preferred first. ?locale= takes precedence
+// over the Accept-Language header. An invalid ?locale= is reported through v.
+func (app *application) readLocales(r *http.Request, v *validator.Validator) []string {
+	if locale := r.URL.Query().Get("locale"); locale != "" {
+		v.Check(validator.Matches(locale, data.LocaleRX), "locale", "must be a locale such as fr or pt-BR")
+		return []string{locale}
+	}
+
+	type weighted struct {
+		locale string
+		q      float64
+	}
+
+	var preferences []weighted
+
+	// Accept-Language is a list such as "fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5". Malformed entries are skipped rather
+	// than rejected, as browsers set the header rather than users.
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		locale, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if locale == "" || locale == "*" {
+			continue
+		}
+
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if q > 0 {
+			preferences = append(preferences, weighted{locale, q})
+		}
+	}
+
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].q > preferences[j].q
+	})
+
+	locales := make([]string, len(preferences))
+	for i, preference := range preferences {
+		locales[i] = preference.locale
+	}
+
+	return locales
+}
+
+// localiseMovies swaps each movie's title for the one best suiting the locales, keeping its own title as the original
+// title and noting the locale of the one used. Movies without a suitable localised title are left as they are.
+func (app *application) localiseMovies(movies []*data.Movie, locales []string) error {
+	if len(movies) == 0 || len(locales) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	titles, err := app.models.Titles.GetAllForMovies(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		title, ok := data.BestTitle(titles[movie.ID], locales)
+		if ok && title.Title != movie.Title {
+			movie.OriginalTitle, movie.Title = movie.Title, title.Title
+			movie.TitleLocale = title.Locale
+		}
+	}
+
+	return nil
+}
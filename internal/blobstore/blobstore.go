@@ -0,0 +1,41 @@
+// Package blobstore stores binary objects, such as uploaded images, under string keys. Keys are slash separated paths
+// like "posters/12/ab34cd.jpg".
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store is implemented by each of the places blobs can be kept.
+type Store interface {
+	// Put stores size bytes read from body under key, replacing any blob already stored there.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under key. ErrNotFound is returned if there isn't one.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a blob which doesn't exist isn't an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey reports whether key is a relative path without any empty, "." or ".." segments, so it can't escape the
+// store it's used with.
+func validKey(key string) bool {
+	if key == "" || strings.ContainsAny(key, "\\\x00") {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,212 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testRegion    = "eu-west-2"
+	testBucket    = "greenlight"
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// newTestS3 returns a store talking to a server which handles each request with handler.
+func newTestS3(t *testing.T, handler http.HandlerFunc) *S3 {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	s, err := NewS3(srv.URL, testRegion, testBucket, testAccessKey, testSecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// checkSignature verifies the request's Signature Version 4 Authorization header as the store would, working from the
+// request as it arrived rather than as it was built.
+func checkSignature(t *testing.T, r *http.Request, payload []byte) {
+	t.Helper()
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != len("20060102T150405Z") {
+		t.Fatalf("got X-Amz-Date %q", amzDate)
+	}
+
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != payloadHash {
+		t.Errorf("got X-Amz-Content-Sha256 %q; want %q", got, payloadHash)
+	}
+
+	canonicalRequest := r.Method + "\n" +
+		r.URL.EscapedPath() + "\n" +
+		r.URL.RawQuery + "\n" +
+		"host:" + r.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n" +
+		"\n" +
+		"host;x-amz-content-sha256;x-amz-date\n" +
+		payloadHash
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := amzDate[:8] + "/" + testRegion + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{amzDate[:8], testRegion, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+
+	want := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/" + scope +
+		", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" + hex.EncodeToString(key)
+
+	if got := r.Header.Get("Authorization"); got != want {
+		t.Errorf("got Authorization %q; want %q", got, want)
+	}
+}
+
+func TestS3Put(t *testing.T) {
+	body := "poster image"
+
+	s := newTestS3(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("got method %s; want PUT", r.Method)
+		}
+
+		if got, want := r.URL.EscapedPath(), "/greenlight/posters/12/my%20poster.jpg"; got != want {
+			t.Errorf("got path %q; want %q", got, want)
+		}
+
+		if got := r.Header.Get("Content-Type"); got != "image/jpeg" {
+			t.Errorf("got Content-Type %q; want image/jpeg", got)
+		}
+
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(payload) != body {
+			t.Errorf("got body %q; want %q", payload, body)
+		}
+
+		checkSignature(t, r, payload)
+	})
+
+	err := s.Put(context.Background(), "posters/12/my poster.jpg", strings.NewReader(body), int64(len(body)), "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestS3Get(t *testing.T) {
+	s := newTestS3(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("got method %s; want GET", r.Method)
+		}
+
+		checkSignature(t, r, nil)
+
+		switch r.URL.Path {
+		case "/greenlight/posters/1.jpg":
+			io.WriteString(w, "poster image")
+		default:
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+		}
+	})
+
+	blob, err := s.Get(context.Background(), "posters/1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+
+	got, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "poster image" {
+		t.Errorf("got blob %q; want %q", got, "poster image")
+	}
+
+	_, err = s.Get(context.Background(), "posters/2.jpg")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v for a missing blob; want %v", err, ErrNotFound)
+	}
+}
+
+func TestS3Delete(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"deleted", http.StatusNoContent, false},
+		{"missing", http.StatusNotFound, false},
+		{"server error", http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestS3(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodDelete {
+					t.Errorf("got method %s; want DELETE", r.Method)
+				}
+
+				checkSignature(t, r, nil)
+				w.WriteHeader(tt.status)
+			})
+
+			err := s.Delete(context.Background(), "posters/1.jpg")
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("got error %v; want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestS3ServerErrors(t *testing.T) {
+	s := newTestS3(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "SlowDown", http.StatusServiceUnavailable)
+	})
+
+	ctx := context.Background()
+
+	err := s.Put(ctx, "posters/1.jpg", strings.NewReader("poster image"), 12, "image/jpeg")
+	if err == nil || !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "SlowDown") {
+		t.Errorf("Put: got error %v; want one describing the 503 response", err)
+	}
+
+	_, err = s.Get(ctx, "posters/1.jpg")
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Get: got error %v; want one describing the 503 response", err)
+	}
+}
+
+func TestS3InvalidKey(t *testing.T) {
+	s := newTestS3(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request for %s", r.URL.Path)
+	})
+
+	_, err := s.Get(context.Background(), "posters/../secrets")
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got error %v; want %v", err, ErrInvalidKey)
+	}
+}
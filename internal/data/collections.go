@@ -0,0 +1,288 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"richwynmorris.co.uk/internal/validator"
+)
+
+var (
+	ErrDuplicateCollectionName = errors.New("duplicate collection name")
+	ErrUnknownMovie            = errors.New("unknown movie")
+)
+
+// Collection is a curated, ordered list of movies, such as a franchise or a set of staff picks. MovieIDs holds the
+// collection's movies in order, leaving out any which have since been deleted; Movies is only filled in when a single
+// collection is shown.
+type Collection struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	MovieIDs    []int64   `json:"movie_ids"`
+	Movies      []*Movie  `json:"movies,omitempty"`
+	Version     int32     `json:"version"`
+}
+
+// ===================== COLLECTION VALIDATION ===============================
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(collection.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+
+	v.Check(collection.MovieIDs != nil, "movie_ids", "must be provided")
+	v.Check(len(collection.MovieIDs) <= 1000, "movie_ids", "must not contain more than 1000 movies")
+	v.Check(validator.Unique(collection.MovieIDs), "movie_ids", "must not contain duplicates")
+
+	for _, id := range collection.MovieIDs {
+		if id < 1 {
+			v.AddError("movie_ids", "must only contain valid movie ids")
+			break
+		}
+	}
+}
+
+// ========================= COLLECTION DATABASE MODEL =======================================
+
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+// Insert creates the collection along with its movies. ErrDuplicateCollectionName is returned if another collection
+// has the same name, ignoring case, and ErrUnknownMovie if any of the movies don't exist.
+func (m CollectionModel) Insert(collection *Collection) error {
+	query := `INSERT INTO collections (name, description)
+			  VALUES ($1, $2)
+			  RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, collection.Name, collection.Description).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.Version,
+	)
+	if err != nil {
+		return collectionError(err)
+	}
+
+	err = m.setMovies(ctx, tx, collection.ID, collection.MovieIDs)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m CollectionModel) Get(id int64) (*Collection, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT id, created_at, name, description, version, ARRAY(
+				  SELECT collection_movies.movie_id FROM collection_movies
+				  INNER JOIN movies ON movies.id = collection_movies.movie_id
+				  WHERE collection_movies.collection_id = collections.id AND movies.deleted_at IS NULL
+				  ORDER BY collection_movies.position, collection_movies.movie_id
+			  )
+			  FROM collections
+			  WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var collection Collection
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.Name,
+		&collection.Description,
+		&collection.Version,
+		pq.Array(&collection.MovieIDs),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &collection, nil
+}
+
+// Update saves the collection if its version still matches the database, replacing its movies with collection.MovieIDs
+// in the order given. It returns the same errors as Insert, and ErrEditConflict on a version mismatch.
+func (m CollectionModel) Update(collection *Collection) error {
+	query := `UPDATE collections
+			  SET name = $1, description = $2, version = version + 1
+			  WHERE id = $3 AND version = $4
+			  RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []any{collection.Name, collection.Description, collection.ID, collection.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&collection.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return collectionError(err)
+		}
+	}
+
+	err = m.setMovies(ctx, tx, collection.ID, collection.MovieIDs)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setMovies replaces the movies in the collection with movieIDs, positioned in the order given. ErrUnknownMovie is
+// returned if any of the movies don't exist or have been deleted, which includes movies merged into another.
+func (m CollectionModel) setMovies(ctx context.Context, tx *sql.Tx, collectionID int64, movieIDs []int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM collection_movies WHERE collection_id = $1`, collectionID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO collection_movies (collection_id, movie_id, position)
+			  SELECT $1, members.movie_id, members.position
+			  FROM unnest($2::bigint[]) WITH ORDINALITY AS members (movie_id, position)
+			  INNER JOIN movies ON movies.id = members.movie_id AND movies.deleted_at IS NULL`
+
+	resp, err := tx.ExecContext(ctx, query, collectionID, pq.Array(movieIDs))
+	if err != nil {
+		return collectionError(err)
+	}
+
+	rowsInserted, err := resp.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsInserted != int64(len(movieIDs)) {
+		return ErrUnknownMovie
+	}
+
+	return nil
+}
+
+func (m CollectionModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM collections
+			  WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	resp, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsDeleted, err := resp.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsDeleted == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll returns the page of collections whose name contains name, or every collection if name is empty.
+func (m CollectionModel) GetAll(name string, filters Filters) ([]*Collection, Metadata, error) {
+	query := fmt.Sprintf(
+		`SELECT count(*) OVER(), id, created_at, name, description, version, ARRAY(
+				  SELECT collection_movies.movie_id FROM collection_movies
+				  INNER JOIN movies ON movies.id = collection_movies.movie_id
+				  WHERE collection_movies.collection_id = collections.id AND movies.deleted_at IS NULL
+				  ORDER BY collection_movies.position, collection_movies.movie_id
+			  )
+			  FROM collections
+			  WHERE (name ILIKE $1 OR $1 = '%%')
+			  ORDER BY %s
+			  LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, "%"+likeEscaper.Replace(name)+"%", filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	collections := []*Collection{}
+
+	for rows.Next() {
+		var collection Collection
+
+		err = rows.Scan(
+			&totalRecords,
+			&collection.ID,
+			&collection.CreatedAt,
+			&collection.Name,
+			&collection.Description,
+			&collection.Version,
+			pq.Array(&collection.MovieIDs),
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		collections = append(collections, &collection)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return collections, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// collectionError maps the constraint violations a collection write can cause onto their errors.
+func collectionError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Constraint {
+		case "collections_name_idx":
+			return ErrDuplicateCollectionName
+		case "collection_movies_movie_id_fkey":
+			return ErrUnknownMovie
+		}
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"richwynmorris.co.uk/internal/validator"
+)
+
+var ErrUnknownPerson = errors.New("unknown person")
+
+// CreditRoles are the parts a person can be credited with on a movie.
+var CreditRoles = []string{"director", "writer", "producer", "cast"}
+
+// Credit records the part a person played in making a movie. Character is only set for cast members.
+type Credit struct {
+	PersonID     int64  `json:"person_id"`
+	Name         string `json:"name,omitempty"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+// ===================== CREDIT VALIDATION ===============================
+
+func ValidateCredits(v *validator.Validator, credits []Credit) {
+	type key struct {
+		personID  int64
+		role      string
+		character string
+	}
+
+	seen := make([]key, 0, len(credits))
+
+	for i, credit := range credits {
+		field := fmt.Sprintf("credits[%d]", i)
+
+		v.Check(credit.PersonID > 0, field+".person_id", "must be provided")
+		v.Check(validator.PermittedValue(credit.Role, CreditRoles...), field+".role", "must be one of director, writer, producer or cast")
+		v.Check(credit.Role == "cast" || credit.Character == "", field+".character", "may only be given for cast")
+		v.Check(len(credit.Character) <= 500, field+".character", "must not be more than 500 bytes long")
+		v.Check(credit.BillingOrder >= 0, field+".billing_order", "must not be negative")
+
+		seen = append(seen, key{credit.PersonID, credit.Role, credit.Character})
+	}
+
+	v.Check(validator.Unique(seen), "credits", "must not contain duplicates")
+}
+
+// ========================= CREDIT DATABASE MODEL =======================================
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+// GetAllForMovie returns the movie's credits in billing order, with each person's name filled in.
+func (m CreditModel) GetAllForMovie(movieID int64) ([]Credit, error) {
+	query := `SELECT movie_credits.person_id, people.name, movie_credits.role, movie_credits.character, movie_credits.billing_order
+			  FROM movie_credits
+			  INNER JOIN people ON people.id = movie_credits.person_id
+			  WHERE movie_credits.movie_id = $1
+			  ORDER BY movie_credits.billing_order, movie_credits.role, people.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err = rows.Scan(&credit.PersonID, &credit.Name, &credit.Role, &credit.Character, &credit.BillingOrder)
+		if err != nil {
+			return nil, err
+		}
+
+		credits = append(credits, credit)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// GetAllForMovies returns the credits of each of the movies, keyed by movie id, in the same order as GetAllForMovie.
+// Movies without credits are left out of the map.
+func (m CreditModel) GetAllForMovies(movieIDs []int64) (map[int64][]Credit, error) {
+	query := `SELECT movie_credits.movie_id, movie_credits.person_id, people.name, movie_credits.role,
+			  movie_credits.character, movie_credits.billing_order
+			  FROM movie_credits
+			  INNER JOIN people ON people.id = movie_credits.person_id
+			  WHERE movie_credits.movie_id = ANY($1)
+			  ORDER BY movie_credits.billing_order, movie_credits.role, people.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make(map[int64][]Credit)
+
+	for rows.Next() {
+		var movieID int64
+		var credit Credit
+
+		err = rows.Scan(&movieID, &credit.PersonID, &credit.Name, &credit.Role, &credit.Character, &credit.BillingOrder)
+		if err != nil {
+			return nil, err
+		}
+
+		credits[movieID] = append(credits[movieID], credit)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// ReplaceForMovie swaps the movie's credits for the ones given, in a single transaction, and bumps the movie's version
+// as they're part of its representation. ErrUnknownPerson is returned if any of the credits refer to a person who
+// doesn't exist.
+func (m CreditModel) ReplaceForMovie(movieID int64, credits []Credit) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movie_credits WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+			  VALUES ($1, $2, $3, $4, $5)`
+
+	for _, credit := range credits {
+		_, err = tx.ExecContext(ctx, query, movieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Constraint == "movie_credits_person_id_fkey" {
+				return ErrUnknownPerson
+			}
+			return err
+		}
+	}
+
+	err = touchMovie(ctx, tx, movieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
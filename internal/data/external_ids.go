@@ -0,0 +1,85 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"richwynmorris.co.uk/internal/validator"
+)
+
+var ErrDuplicateExternalID = errors.New("duplicate external id")
+
+// ExternalIDProviders lists the providers a movie can hold an external id for.
+var ExternalIDProviders = []string{"imdb", "tmdb", "eidr"}
+
+// externalIDRX holds the format of each provider's ids, e.g. tt0078748 on IMDb, 348 on TMDB and
+// 10.5240/EA73-8E3A-DD24-2E1F-9C3A-X on EIDR.
+var externalIDRX = map[string]*regexp.Regexp{
+	"imdb": regexp.MustCompile(`^tt[0-9]{7,8}$`),
+	"tmdb": regexp.MustCompile(`^[1-9][0-9]{0,9}$`),
+	"eidr": regexp.MustCompile(`^10\.5240/([0-9A-F]{4}-){5}[0-9A-Z]$`),
+}
+
+// ExternalIDs maps a provider to the id the movie has with them. It's stored as a jsonb object.
+type ExternalIDs map[string]string
+
+// Value encodes the ids as JSON for storing, writing no ids as an empty object rather than null.
+func (e ExternalIDs) Value() (driver.Value, error) {
+	if e == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(e)
+}
+
+// Scan decodes ids stored as JSON. An empty object is read as a nil map, so it's left out of responses.
+func (e *ExternalIDs) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return errors.New("external ids must be read from a jsonb column")
+	}
+
+	var ids map[string]string
+
+	err := json.Unmarshal(b, &ids)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		ids = nil
+	}
+
+	*e = ids
+	return nil
+}
+
+// ===================== EXTERNAL ID VALIDATION ===============================
+
+func ValidateExternalID(v *validator.Validator, provider, id string) {
+	key := "external_ids." + provider
+
+	rx, ok := externalIDRX[provider]
+	if !ok {
+		v.AddError(key, "must be one of imdb, tmdb or eidr")
+		return
+	}
+
+	v.Check(validator.Matches(id, rx), key, "must be a valid "+provider+" id")
+}
+
+func ValidateExternalIDs(v *validator.Validator, ids ExternalIDs) {
+	for provider, id := range ids {
+		ValidateExternalID(v, provider, id)
+	}
+}
+
+// isDuplicateExternalID reports whether err is a violation of one of the unique indexes on external ids.
+func isDuplicateExternalID(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && strings.HasPrefix(pqErr.Constraint, "movies_external_ids_")
+}
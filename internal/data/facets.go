@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FacetNames lists the facets which can be counted over a movie listing.
+var FacetNames = []string{"genres", "year", "runtime"}
+
+// FacetCount is the number of movies in a listing which share a facet value, e.g. a genre or a decade.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets maps each requested facet name to its counts.
+type Facets map[string][]FacetCount
+
+// facetQueries holds the query counting each facet. Every query has a %s verb for the WHERE clause of the listing,
+// so the counts cover exactly the movies the listing does.
+var facetQueries = map[string]string{
+	"genres": `SELECT genre, count(*)
+			  FROM movies, unnest(genres) AS genre
+			  WHERE %s
+			  GROUP BY genre
+			  ORDER BY count(*) DESC, genre ASC`,
+	"year": `SELECT (year / 10 * 10)::text || 's', count(*)
+			  FROM movies
+			  WHERE %s
+			  GROUP BY year / 10
+			  ORDER BY year / 10 ASC`,
+	"runtime": `SELECT CASE
+				  WHEN runtime < 90 THEN '0-89'
+				  WHEN runtime < 120 THEN '90-119'
+				  WHEN runtime < 150 THEN '120-149'
+				  ELSE '150+'
+			  END, count(*)
+			  FROM movies
+			  WHERE %s
+			  GROUP BY 1
+			  ORDER BY min(runtime) ASC`,
+}
+
+// Facets counts the movies meeting the criteria by each of the named facets. Genres are counted most common first,
+// years by decade and runtimes in half hour buckets from 90 minutes, both in ascending order.
+func (m MovieModel) Facets(criteria MovieCriteria, names []string) (Facets, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	facets := Facets{}
+
+	for _, name := range names {
+		var args queryArgs
+
+		query, ok := facetQueries[name]
+		if !ok {
+			// The handler has already checked names against FacetNames, so this is a failsafe.
+			panic("unknown facet: " + name)
+		}
+
+		rows, err := m.DB.QueryContext(ctx, fmt.Sprintf(query, criteria.where(&args)), args...)
+		if err != nil {
+			return nil, err
+		}
+
+		counts := []FacetCount{}
+
+		for rows.Next() {
+			var count FacetCount
+
+			err = rows.Scan(&count.Value, &count.Count)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			counts = append(counts, count)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		facets[name] = counts
+	}
+
+	return facets, nil
+}
@@ -1,25 +1,91 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"richwynmorris.co.uk/internal/validator"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	Cursor       *Cursor
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"previous_cursor,omitempty"`
+}
+
+// Cursor marks a position in a sorted listing. It holds the value of the sort column and the id of the row at that
+// position, so the next (or previous) page can be selected with a keyset condition rather than an OFFSET.
+type Cursor struct {
+	Sort     string `json:"s"`
+	Value    string `json:"v"`
+	ID       int64  `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// Encode returns the cursor as an opaque, URL safe string to be handed to the client.
+func (c Cursor) Encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// DecodeCursor parses a cursor string previously produced by Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+
+	err = json.Unmarshal(js, &cursor)
+	if err != nil || cursor.Sort == "" || cursor.ID < 1 || !cursor.validValue() {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// validValue reports whether the cursor's value parses as the type of its sort column, so a tampered cursor is
+// rejected rather than failing in the database. Text columns accept any value.
+func (c Cursor) validValue() bool {
+	var err error
+
+	switch strings.TrimPrefix(c.Sort, "-") {
+	case "id":
+		_, err = strconv.ParseInt(c.Value, 10, 64)
+	case "year", "runtime", "rating_count":
+		_, err = strconv.ParseInt(c.Value, 10, 32)
+	case "average_rating", "relevance", "similarity":
+		var f float64
+		f, err = strconv.ParseFloat(c.Value, 64)
+		if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			return false
+		}
+	case "created_at":
+		_, err = time.Parse(time.RFC3339, c.Value)
+	}
+
+	return err == nil
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -29,6 +95,11 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "maximum page size is 100")
 
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	if f.Cursor != nil {
+		v.Check(f.Page == 1, "page", "cannot be combined with cursor")
+		v.Check(f.Cursor.Sort == f.Sort, "cursor", "cursor does not match the sort value")
+	}
 }
 
 func (f Filters) sortColumn() string {
@@ -57,6 +128,63 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// backward reports whether the filters page backwards from a cursor.
+func (f Filters) backward() bool {
+	return f.Cursor != nil && f.Cursor.Backward
+}
+
+// orderBy returns the ORDER BY clause for the sort, using id as the tiebreaker. When paging backwards from a cursor
+// both directions are flipped so the rows nearest the cursor are read first; callers reverse them afterwards.
+func (f Filters) orderBy() string {
+	direction, idDirection := f.sortDirection(), "ASC"
+
+	if f.backward() {
+		direction, idDirection = flipDirection(direction), "DESC"
+	}
+
+	return fmt.Sprintf("%s %s, id %s", f.sortColumn(), direction, idDirection)
+}
+
+// keysetCondition returns the predicate selecting the rows after (or before) the cursor in the sort order. The
+// cursor's sort value and id are added to args.
+func (f Filters) keysetCondition(args *queryArgs) string {
+	op, idOp := ">", ">"
+	if f.sortDirection() == "DESC" {
+		op = "<"
+	}
+
+	if f.backward() {
+		op, idOp = flipOperator(op), "<"
+	}
+
+	value, id := args.add(f.Cursor.Value), args.add(f.Cursor.ID)
+
+	return fmt.Sprintf("(%[1]s %[2]s %[4]s OR (%[1]s = %[4]s AND id %[3]s %[5]s))", f.sortColumn(), op, idOp, value, id)
+}
+
+func flipDirection(direction string) string {
+	if direction == "ASC" {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func flipOperator(op string) string {
+	if op == ">" {
+		return "<"
+	}
+	return ">"
+}
+
+// queryArgs collects the values for a query's placeholders as the query is built up.
+type queryArgs []any
+
+// add appends the value to the arguments and returns the placeholder which refers to it.
+func (a *queryArgs) add(value any) string {
+	*a = append(*a, value)
+	return "$" + strconv.Itoa(len(*a))
+}
+
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	if totalRecords == 0 {
 		return Metadata{}
@@ -0,0 +1,52 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  Cursor
+		wantErr bool
+	}{
+		{"id", Cursor{Sort: "id", Value: "42", ID: 42}, false},
+		{"year", Cursor{Sort: "-year", Value: "1999", ID: 7}, false},
+		{"rating", Cursor{Sort: "average_rating", Value: "7.25", ID: 7}, false},
+		{"created at", Cursor{Sort: "created_at", Value: "2024-03-01T12:00:00Z", ID: 7}, false},
+		{"title", Cursor{Sort: "title", Value: "anything at all", ID: 7}, false},
+		{"year not a number", Cursor{Sort: "year", Value: "abc", ID: 1}, true},
+		{"year out of range", Cursor{Sort: "year", Value: "4294969296", ID: 1}, true},
+		{"rating not a number", Cursor{Sort: "-average_rating", Value: "high", ID: 1}, true},
+		{"rating NaN", Cursor{Sort: "relevance", Value: "NaN", ID: 1}, true},
+		{"created at not a time", Cursor{Sort: "created_at", Value: "yesterday", ID: 1}, true},
+		{"missing id", Cursor{Sort: "id", Value: "1"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCursor(tt.cursor.Encode())
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCursor) {
+					t.Errorf("got error %v; want %v", err, ErrInvalidCursor)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *got != tt.cursor {
+				t.Errorf("got cursor %+v; want %+v", *got, tt.cursor)
+			}
+		})
+	}
+
+	_, err := DecodeCursor("not base64!")
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("got error %v for a malformed cursor; want %v", err, ErrInvalidCursor)
+	}
+}
@@ -11,17 +11,33 @@ var (
 )
 
 type Models struct {
+	Collections CollectionModel
+	Credits     CreditModel
 	Movies      MovieModel
+	People      PersonModel
 	Permissions PermissionModel
+	Posters     PosterModel
+	Reviews     ReviewModel
+	Revisions   RevisionModel
 	Tokens      TokenModel
+	Titles      MovieTitleModel
 	Users       UserModel
+	Watchlist   WatchlistModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
+		Collections: CollectionModel{DB: db},
+		Credits:     CreditModel{DB: db},
 		Movies:      MovieModel{DB: db},
+		People:      PersonModel{DB: db},
 		Permissions: PermissionModel{DB: db},
+		Posters:     PosterModel{DB: db},
+		Reviews:     ReviewModel{DB: db},
+		Revisions:   RevisionModel{DB: db},
 		Tokens:      TokenModel{DB: db},
+		Titles:      MovieTitleModel{DB: db},
 		Users:       UserModel{DB: db},
+		Watchlist:   WatchlistModel{DB: db},
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -13,13 +15,75 @@ import (
 )
 
 type Movie struct {
-	ID        int64     `json:"id,omitempty"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID            int64       `json:"id,omitempty"`
+	CreatedAt     time.Time   `json:"-"`
+	Title         string      `json:"title"`
+	OriginalTitle string      `json:"original_title,omitempty"`
+	Year          int32       `json:"year,omitempty"`
+	Runtime       Runtime     `json:"runtime,omitempty"`
+	Genres        []string    `json:"genres,omitempty"`
+	Version       int32       `json:"version"`
+	DeletedAt     *time.Time  `json:"deleted_at,omitempty"`
+	AverageRating float64     `json:"average_rating,omitempty"`
+	RatingCount   int32       `json:"rating_count,omitempty"`
+	ExternalIDs   ExternalIDs `json:"external_ids,omitempty"`
+	PosterURL     string      `json:"poster_url,omitempty"`
+	Score         float64     `json:"score,omitempty"`
+	TitleLocale   string      `json:"-"`
+}
+
+// MovieFields lists the fields of a movie which a sparse fieldset can pick from.
+var MovieFields = []string{
+	"id", "title", "year", "runtime", "genres", "version", "deleted_at", "average_rating", "rating_count", "score",
+	"external_ids", "poster_url",
+}
+
+// movieColumns maps each of MovieFields to the column it's read from and where that column is scanned to.
+var movieColumns = map[string]struct {
+	column string
+	dest   func(movie *Movie) any
+}{
+	"id":             {"id", func(movie *Movie) any { return &movie.ID }},
+	"title":          {"title", func(movie *Movie) any { return &movie.Title }},
+	"year":           {"year", func(movie *Movie) any { return &movie.Year }},
+	"runtime":        {"runtime", func(movie *Movie) any { return &movie.Runtime }},
+	"genres":         {"genres", func(movie *Movie) any { return pq.Array(&movie.Genres) }},
+	"version":        {"version", func(movie *Movie) any { return &movie.Version }},
+	"deleted_at":     {"deleted_at", func(movie *Movie) any { return &movie.DeletedAt }},
+	"average_rating": {"average_rating", func(movie *Movie) any { return &movie.AverageRating }},
+	"rating_count":   {"rating_count", func(movie *Movie) any { return &movie.RatingCount }},
+	"score":          {"relevance", func(movie *Movie) any { return &movie.Score }},
+	"external_ids":   {"external_ids", func(movie *Movie) any { return &movie.ExternalIDs }},
+	"poster_url":     {"poster_url", func(movie *Movie) any { return &movie.PosterURL }},
+}
+
+// movieSelection returns the column list for reading the fields of a movie, and a function giving the destinations
+// to scan them into. The id and sort column are always read, as cursors are built from them. No fields reads them all.
+func movieSelection(fields []string, filters Filters) (string, func(movie *Movie) []any) {
+	sortField := filters.sortColumn()
+	if sortField == "relevance" {
+		sortField = "score"
+	}
+
+	var columns []string
+	var dests []func(movie *Movie) any
+
+	for _, field := range MovieFields {
+		if len(fields) > 0 && field != "id" && field != sortField && !validator.PermittedValue(field, fields...) {
+			continue
+		}
+
+		columns = append(columns, movieColumns[field].column)
+		dests = append(dests, movieColumns[field].dest)
+	}
+
+	return strings.Join(columns, ", "), func(movie *Movie) []any {
+		scan := make([]any, len(dests))
+		for i, dest := range dests {
+			scan[i] = dest(movie)
+		}
+		return scan
+	}
 }
 
 // ===================== MOVIE VALIDATION ===============================
@@ -39,6 +103,8 @@ func ValidateMovie(v *validator.Validator, input *Movie) {
 	v.Check(len(input.Genres) >= 1, "genres", "a minimum of one genre must be selected")
 	v.Check(len(input.Genres) <= 5, "genres", "There cannot be more than 5 genres selected")
 	v.Check(validator.Unique(input.Genres), "genres", "genres cannot contain duplicates")
+
+	ValidateExternalIDs(v, input.ExternalIDs)
 }
 
 // =========================== MOVIE MODEL FUNCTIONALITY =================================
@@ -47,18 +113,101 @@ type MovieModel struct {
 	DB *sql.DB
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
+// Insert adds the movie to the database and records its first revision against the user who created it.
+func (m MovieModel) Insert(movie *Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertMovie(ctx, tx, movie, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertMany adds a batch of movies in a single transaction. If partial is false the first failure aborts the whole
+// batch and is returned as err. If partial is true each movie is inserted under its own savepoint, so a movie that
+// fails is rolled back on its own and its error is returned at the same index of failures, while the rest of the
+// batch is committed. The caller's ctx bounds the transaction, as its size depends on the batch.
+func (m MovieModel) InsertMany(ctx context.Context, movies []*Movie, userID int64, partial bool) (failures []error, err error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	failures = make([]error, len(movies))
+
+	for i, movie := range movies {
+		if !partial {
+			err = insertMovie(ctx, tx, movie, userID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, "SAVEPOINT insert_movie")
+		if err != nil {
+			return nil, err
+		}
+
+		err = insertMovie(ctx, tx, movie, userID)
+		if err != nil {
+			failures[i] = err
+			movie.ID = 0
+
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT insert_movie")
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT insert_movie")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return failures, tx.Commit()
+}
+
+// touchMovie bumps the movie's version as part of tx, for writes to the data shown alongside a movie, such as its
+// credits, which don't otherwise change it. The new version gives the movie a new entity tag, so cached copies are
+// refetched. No revision is recorded, as nothing in the movie's own editable state changed.
+func touchMovie(ctx context.Context, tx *sql.Tx, movieID int64) error {
+	_, err := tx.ExecContext(ctx, `UPDATE movies SET version = version + 1 WHERE id = $1`, movieID)
+	return err
+}
+
+// insertMovie inserts the movie and its first revision as part of tx.
+func insertMovie(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
 	query := `
-	INSERT INTO movies (title, year, runtime, genres)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO movies (title, year, runtime, genres, external_ids)
+	VALUES ($1, $2, $3, $4, $5)
 	RETURNING id, created_at, version`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ExternalIDs}
 
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		switch {
+		case isDuplicateExternalID(err):
+			return ErrDuplicateExternalID
+		default:
+			return err
+		}
+	}
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	return insertRevision(ctx, tx, RevisionInsert, nil, movie, userID)
 }
 
 func (m MovieModel) Get(id int64) (*Movie, error) {
@@ -66,8 +215,11 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT id, created_at, title, year, runtime, genres, version FROM movies
-			  WHERE id = $1`
+	query := `SELECT id, created_at, title, year, runtime, genres, version, deleted_at, average_rating, rating_count,
+			  external_ids, poster_url
+			  FROM movies
+			  WHERE id = $1
+			  AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -82,6 +234,11 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
 		&movie.Version,
+		&movie.DeletedAt,
+		&movie.AverageRating,
+		&movie.RatingCount,
+		&movie.ExternalIDs,
+		&movie.PosterURL,
 	)
 
 	if err != nil {
@@ -95,10 +252,158 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 
 	return &movie, nil
 }
-func (m MovieModel) Update(movie *Movie) error {
-	query := `UPDATE movies
-			  SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-			  WHERE id = $5 AND version = $6
+
+// GetFields returns the movie with only the fields named read, along with its id and version, which its entity tag is
+// built from. No fields reads the whole movie. A soft deleted movie is only returned if includeDeleted is true.
+func (m MovieModel) GetFields(id int64, fields []string, includeDeleted bool) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	if len(fields) > 0 {
+		fields = append(fields[:len(fields):len(fields)], "version")
+	}
+
+	columns, dests := movieSelection(fields, Filters{Sort: "id", SortSafeList: []string{"id"}})
+
+	// A single movie has no search relevance, but the score field still needs a column to be read from.
+	query := fmt.Sprintf(
+		`SELECT %s
+			  FROM movies, LATERAL (SELECT 0::double precision AS relevance) AS search
+			  WHERE id = $1
+			  AND (deleted_at IS NULL OR $2)`, columns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movie Movie
+
+	err := m.DB.QueryRowContext(ctx, query, id, includeDeleted).Scan(dests(&movie)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// GetMany returns the movies with the given ids, in the same order as the ids, with a single query. Ids of movies
+// which were merged into another resolve to the movie they were merged into, as GetRedirect does, and are returned in
+// redirects mapped to that movie's id. The ids of movies which don't exist (or have been deleted) are returned in
+// missing, also in order.
+func (m MovieModel) GetMany(ids []int64) (movies []*Movie, redirects map[int64]int64, missing []int64, err error) {
+	query := `SELECT requested.id, movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+			  movies.version, movies.deleted_at, movies.average_rating, movies.rating_count, movies.external_ids,
+			  movies.poster_url
+			  FROM unnest($1::bigint[]) AS requested (id)
+			  LEFT JOIN movie_redirects ON movie_redirects.old_id = requested.id
+			  INNER JOIN movies ON movies.id = COALESCE(movie_redirects.movie_id, requested.id)
+			  WHERE movies.deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[int64]*Movie, len(ids))
+
+	for rows.Next() {
+		var requestedID int64
+		var movie Movie
+
+		err = rows.Scan(
+			&requestedID,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.DeletedAt,
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.ExternalIDs,
+			&movie.PosterURL,
+		)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		found[requestedID] = &movie
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	movies, redirects, missing = []*Movie{}, map[int64]int64{}, []int64{}
+
+	for _, id := range ids {
+		movie, ok := found[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+
+		movies = append(movies, movie)
+
+		if movie.ID != id {
+			redirects[id] = movie.ID
+		}
+	}
+
+	return movies, redirects, missing, nil
+}
+
+// Update saves the movie if its version still matches the database, and records a revision of the fields that
+// changed against the user who made the change.
+func (m MovieModel) Update(movie *Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the stored row so the revision is diffed against exactly the version being replaced.
+	query := `SELECT id, title, year, runtime, genres, version, external_ids FROM movies
+			  WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+			  FOR UPDATE`
+
+	var before Movie
+
+	err = tx.QueryRowContext(ctx, query, movie.ID, movie.Version).Scan(
+		&before.ID,
+		&before.Title,
+		&before.Year,
+		&before.Runtime,
+		pq.Array(&before.Genres),
+		&before.Version,
+		&before.ExternalIDs,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `UPDATE movies
+			  SET title = $1, year = $2, runtime = $3, genres = $4, external_ids = $5, version = version + 1
+			  WHERE id = $6 AND version = $7
               RETURNING version`
 
 	args := []any{
@@ -106,86 +411,844 @@ func (m MovieModel) Update(movie *Movie) error {
 		movie.Year,
 		movie.Runtime,
 		pq.Array(movie.Genres),
+		movie.ExternalIDs,
 		movie.ID,
 		movie.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	// QueryRow expects to return a single row from the db, if it doesn't it throws and error.
 	// Query row takes two args: the query and the values to be interpolated into the query.
 	// We do this to prevent SQL injection attacks.
 	// We also use the rest syntax to explode the values in the slice.
 	// The Scan method receives the result of the query and copies the return values into the destination argument.
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
+		case isDuplicateExternalID(err):
+			return ErrDuplicateExternalID
 		default:
 			return err
 		}
 	}
 
-	// Return nil as success if update operation performed correctly.
-	return nil
+	err = insertRevision(ctx, tx, RevisionUpdate, &before, movie, userID)
+	if err != nil {
+		return err
+	}
+
+	// Return the result of the commit as success if update operation performed correctly.
+	return tx.Commit()
 }
-func (m MovieModel) Delete(id int64) error {
+
+// Delete soft deletes the movie, hiding it from Get and GetAll until it is restored or purged. The version is the one
+// the caller expects to delete, and ErrEditConflict is returned if the movie has moved on since. A version of zero
+// deletes whichever version is current.
+func (m MovieModel) Delete(id int64, version int32, userID int64) error {
+	_, err := m.setDeleted(id, true, version, userID)
+	return err
+}
+
+// Restore brings back a soft deleted movie and returns it.
+func (m MovieModel) Restore(id int64, userID int64) (*Movie, error) {
+	return m.setDeleted(id, false, 0, userID)
+}
+
+// setDeleted moves the movie in or out of the soft deleted state, bumping its version and recording the change as a
+// revision. ErrRecordNotFound is returned if the movie doesn't exist or is already in the requested state, and
+// ErrEditConflict if a non-zero version doesn't match the current one.
+func (m MovieModel) setDeleted(id int64, deleted bool, version int32, userID int64) (*Movie, error) {
 	if id < 1 {
-		return ErrRecordNotFound
+		return nil, ErrRecordNotFound
 	}
 
-	query := `
-			 DELETE FROM movies
-			 WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	movie, err := setDeletedTx(ctx, tx, id, deleted, version, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return movie, nil
+}
+
+// setDeletedTx does the work of setDeleted as part of the transaction tx. Restoring a movie drops any redirect left
+// from merging it into another, so its id refers to it again. Deleted movies don't hold on to their external ids, so
+// ErrDuplicateExternalID is returned if another movie has taken one of them in the meantime.
+func setDeletedTx(ctx context.Context, tx *sql.Tx, id int64, deleted bool, version int32, userID int64) (*Movie, error) {
+	query := `SELECT id, created_at, title, year, runtime, genres, version, deleted_at, average_rating, rating_count,
+			  external_ids, poster_url
+			  FROM movies
+			  WHERE id = $1 AND (deleted_at IS NULL) = $2
+			  FOR UPDATE`
+
+	var before Movie
+
+	err := tx.QueryRowContext(ctx, query, id, deleted).Scan(
+		&before.ID,
+		&before.CreatedAt,
+		&before.Title,
+		&before.Year,
+		&before.Runtime,
+		pq.Array(&before.Genres),
+		&before.Version,
+		&before.DeletedAt,
+		&before.AverageRating,
+		&before.RatingCount,
+		&before.ExternalIDs,
+		&before.PosterURL,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if version != 0 && before.Version != version {
+		return nil, ErrEditConflict
+	}
+
+	query = `UPDATE movies
+			 SET deleted_at = CASE WHEN $2 THEN NOW() END, version = version + 1
+			 WHERE id = $1
+			 RETURNING deleted_at, version`
+
+	after := before
+
+	err = tx.QueryRowContext(ctx, query, id, deleted).Scan(&after.DeletedAt, &after.Version)
+	if err != nil {
+		switch {
+		case isDuplicateExternalID(err):
+			return nil, ErrDuplicateExternalID
+		default:
+			return nil, err
+		}
+	}
+
+	action := RevisionRestore
+	if deleted {
+		action = RevisionDelete
+	}
+
+	err = insertRevision(ctx, tx, action, &before, &after, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !deleted {
+		_, err = tx.ExecContext(ctx, `DELETE FROM movie_redirects WHERE old_id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &after, nil
+}
+
+// FindDuplicates runs the same check as FindDuplicate for a batch of movies with a single query. existing holds the
+// id of a movie each one duplicates, or 0 if there isn't one, and earlier holds the index of the first movie before
+// it in the batch which it duplicates, or -1.
+func (m MovieModel) FindDuplicates(ctx context.Context, movies []*Movie) (existing []int64, earlier []int, err error) {
+	query := `WITH candidates AS (
+				  SELECT ordinality, year, lower(regexp_replace(title, '[^[:alnum:]]+', '', 'g')) AS normalised_title
+				  FROM unnest($1::text[], $2::integer[]) WITH ORDINALITY AS candidates (title, year, ordinality)
+			  )
+			  SELECT ordinality, (
+				  SELECT min(movies.id) FROM movies
+				  WHERE lower(regexp_replace(movies.title, '[^[:alnum:]]+', '', 'g')) = candidates.normalised_title
+				  AND movies.year = candidates.year
+				  AND movies.deleted_at IS NULL
+			  ), (
+				  SELECT min(earlier.ordinality) FROM candidates AS earlier
+				  WHERE earlier.normalised_title = candidates.normalised_title
+				  AND earlier.year = candidates.year
+				  AND earlier.ordinality < candidates.ordinality
+			  )
+			  FROM candidates`
+
+	titles := make([]string, len(movies))
+	years := make([]int32, len(movies))
+	for i, movie := range movies {
+		titles[i], years[i] = movie.Title, movie.Year
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(titles), pq.Array(years))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	existing = make([]int64, len(movies))
+	earlier = make([]int, len(movies))
+
+	for rows.Next() {
+		var ordinality int
+		var existingID, earlierOrdinality sql.NullInt64
+
+		err = rows.Scan(&ordinality, &existingID, &earlierOrdinality)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Ordinalities count from 1.
+		existing[ordinality-1] = existingID.Int64
+		earlier[ordinality-1] = int(earlierOrdinality.Int64) - 1
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return existing, earlier, nil
+}
+
+// FindDuplicate returns a movie which looks like a duplicate of one with the given title and year: one from the same
+// year whose title matches ignoring case, spacing and punctuation. ErrRecordNotFound is returned if there isn't one.
+func (m MovieModel) FindDuplicate(title string, year int32) (*Movie, error) {
+	query := `SELECT id, created_at, title, year, runtime, genres, version, deleted_at, average_rating, rating_count,
+			  external_ids, poster_url
+			  FROM movies
+			  WHERE lower(regexp_replace(title, '[^[:alnum:]]+', '', 'g')) = lower(regexp_replace($1, '[^[:alnum:]]+', '', 'g'))
+			  AND year = $2
+			  AND deleted_at IS NULL
+			  ORDER BY id
+			  LIMIT 1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	resp, err := m.DB.ExecContext(ctx, query, id)
+	var movie Movie
+
+	err := m.DB.QueryRowContext(ctx, query, title, year).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.DeletedAt,
+		&movie.AverageRating,
+		&movie.RatingCount,
+		&movie.ExternalIDs,
+		&movie.PosterURL,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// Merge folds the duplicate movie into the canonical one. The duplicate's credits, titles, reviews, watchlist entries
+// and collection memberships are moved across, except where the canonical movie already has an equivalent (e.g. a
+// review by the same user or a title in the same locale), and the duplicate is then deleted. The duplicate's original
+// title is kept as an alternate title if the canonical movie already has one. A redirect from the duplicate's id to
+// the canonical movie is kept, and redirects which pointed at the duplicate are pointed at the canonical movie
+// instead. The duplicate's poster is dropped rather than moved, and returned, if it had one, so its images can be
+// removed from the blob store. ErrRecordNotFound is returned if either movie doesn't exist.
+func (m MovieModel) Merge(duplicateID, canonicalID int64, userID int64) (*Movie, *Poster, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock both movies, in id order so that concurrent merges can't deadlock.
+	var locked int
+
+	query := `SELECT count(*) FROM (
+				  SELECT id FROM movies
+				  WHERE id = ANY($1) AND deleted_at IS NULL
+				  ORDER BY id
+				  FOR UPDATE
+			  ) AS locked`
+
+	err = tx.QueryRowContext(ctx, query, pq.Array([]int64{duplicateID, canonicalID})).Scan(&locked)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if locked != 2 {
+		return nil, nil, ErrRecordNotFound
+	}
+
+	queries := []string{
+		`INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+		 SELECT $2, person_id, role, character, billing_order FROM movie_credits WHERE movie_id = $1
+		 ON CONFLICT DO NOTHING`,
+		`DELETE FROM movie_credits WHERE movie_id = $1`,
+		`INSERT INTO movie_titles (movie_id, locale, title, is_original)
+		 SELECT $2, locale, title, is_original AND NOT EXISTS (
+			 SELECT 1 FROM movie_titles WHERE movie_id = $2 AND is_original
+		 )
+		 FROM movie_titles WHERE movie_id = $1
+		 ON CONFLICT DO NOTHING`,
+		`DELETE FROM movie_titles WHERE movie_id = $1`,
+		`UPDATE reviews SET movie_id = $2
+		 WHERE movie_id = $1
+		 AND user_id NOT IN (SELECT user_id FROM reviews WHERE movie_id = $2)`,
+		`INSERT INTO watchlist_items (user_id, movie_id, added_at, watched_at)
+		 SELECT user_id, $2, added_at, watched_at FROM watchlist_items WHERE movie_id = $1
+		 ON CONFLICT DO NOTHING`,
+		`DELETE FROM watchlist_items WHERE movie_id = $1`,
+		`INSERT INTO collection_movies (collection_id, movie_id, position)
+		 SELECT collection_id, $2, position FROM collection_movies WHERE movie_id = $1
+		 ON CONFLICT DO NOTHING`,
+		`DELETE FROM collection_movies WHERE movie_id = $1`,
+		`UPDATE movie_redirects SET movie_id = $2 WHERE movie_id = $1`,
+		`INSERT INTO movie_redirects (old_id, movie_id) VALUES ($1, $2)
+		 ON CONFLICT (old_id) DO UPDATE SET movie_id = EXCLUDED.movie_id, created_at = NOW()`,
+	}
+
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, query, duplicateID, canonicalID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The canonical movie's credits and titles may have changed, so it needs a new entity tag.
+	err = touchMovie(ctx, tx, canonicalID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = mergeExternalIDs(ctx, tx, duplicateID, canonicalID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	poster, err := removePoster(ctx, tx, duplicateID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = setDeletedTx(ctx, tx, duplicateID, true, 0, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, id := range []int64{duplicateID, canonicalID} {
+		err = updateMovieRating(ctx, tx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	movie, err := m.Get(canonicalID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return movie, poster, nil
+}
+
+// mergeExternalIDs gives the canonical movie any external ids the duplicate has which it doesn't, recording a revision
+// of the canonical movie if that changes it. The duplicate's ids are cleared first, as each id can only belong to one
+// movie.
+func mergeExternalIDs(ctx context.Context, tx *sql.Tx, duplicateID, canonicalID int64, userID int64) error {
+	query := `UPDATE movies
+			  SET external_ids = '{}'
+			  FROM (SELECT external_ids FROM movies WHERE id = $1) AS previous
+			  WHERE movies.id = $1
+			  RETURNING previous.external_ids`
+
+	var duplicateIDs ExternalIDs
+
+	err := tx.QueryRowContext(ctx, query, duplicateID).Scan(&duplicateIDs)
 	if err != nil {
 		return err
 	}
 
-	rowsDeleted, err := resp.RowsAffected()
+	query = `SELECT id, title, year, runtime, genres, version, external_ids FROM movies
+			 WHERE id = $1`
+
+	var before Movie
+
+	err = tx.QueryRowContext(ctx, query, canonicalID).Scan(
+		&before.ID,
+		&before.Title,
+		&before.Year,
+		&before.Runtime,
+		pq.Array(&before.Genres),
+		&before.Version,
+		&before.ExternalIDs,
+	)
 	if err != nil {
 		return err
 	}
 
-	if rowsDeleted == 0 {
-		return ErrRecordNotFound
+	after := before
+	after.ExternalIDs = ExternalIDs{}
+
+	for provider, id := range duplicateIDs {
+		after.ExternalIDs[provider] = id
+	}
+	for provider, id := range before.ExternalIDs {
+		after.ExternalIDs[provider] = id
+	}
+
+	if len(after.ExternalIDs) == len(before.ExternalIDs) {
+		return nil
+	}
+
+	query = `UPDATE movies
+			 SET external_ids = $1, version = version + 1
+			 WHERE id = $2
+			 RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, after.ExternalIDs, canonicalID).Scan(&after.Version)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	return insertRevision(ctx, tx, RevisionUpdate, &before, &after, userID)
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
-	query := fmt.Sprintf(
-		`SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+// GetByExternalID returns the movie holding the external id with the provider.
+func (m MovieModel) GetByExternalID(provider, externalID string) (*Movie, error) {
+	// The provider is written into the query so that its unique index can be used. The handler has already checked it
+	// against ExternalIDProviders, so this is a failsafe.
+	if _, ok := externalIDRX[provider]; !ok {
+		panic("unknown external id provider: " + provider)
+	}
+
+	query := fmt.Sprintf(`
+			  SELECT id, created_at, title, year, runtime, genres, version, deleted_at, average_rating, rating_count,
+			  external_ids, poster_url
 			  FROM movies
-			  WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1 ) OR $1 = '')
-			  AND (genres @> $2 OR $2 = '{}')
-			  ORDER BY %s %s, id ASC
-			  LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+			  WHERE external_ids->>'%s' = $1
+			  AND deleted_at IS NULL`, provider)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movie Movie
+
+	err := m.DB.QueryRowContext(ctx, query, externalID).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.DeletedAt,
+		&movie.AverageRating,
+		&movie.RatingCount,
+		&movie.ExternalIDs,
+		&movie.PosterURL,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// GetRedirect returns the id of the movie that the movie with the given id was merged into. ErrRecordNotFound is
+// returned if it wasn't merged.
+func (m MovieModel) GetRedirect(id int64) (int64, error) {
+	query := `SELECT movie_id FROM movie_redirects
+			  WHERE old_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movieID int64
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return movieID, nil
+}
+
+// Purge permanently removes movies that were soft deleted before the cutoff, returning how many were removed. Their
+// revisions, credits and other dependent rows are removed along with them by the foreign keys' cascades. The posters
+// of the removed movies are returned so their images can be removed from the blob store.
+func (m MovieModel) Purge(cutoff time.Time) (int64, []*Poster, error) {
+	// Every part of the statement sees the tables as they were before it ran, so the posters can still be read while
+	// the cascade removes them.
+	query := `WITH purged AS (
+				  DELETE FROM movies
+				  WHERE deleted_at < $1
+				  RETURNING id
+			  )
+			  SELECT purged.id, movie_posters.key, movie_posters.content_type, movie_posters.thumbnail_key
+			  FROM purged
+			  LEFT JOIN movie_posters ON movie_posters.movie_id = purged.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var purged int64
+	var posters []*Poster
+
+	for rows.Next() {
+		var movieID int64
+		var key, contentType, thumbnailKey sql.NullString
+
+		err = rows.Scan(&movieID, &key, &contentType, &thumbnailKey)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		purged++
+
+		if key.Valid {
+			posters = append(posters, &Poster{
+				MovieID:      movieID,
+				Key:          key.String,
+				ContentType:  contentType.String,
+				ThumbnailKey: thumbnailKey.String,
+			})
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return purged, posters, nil
+}
+
+// MovieCriteria holds the conditions a listing of movies is narrowed down by. The zero value matches every movie that
+// hasn't been deleted. Genres must all be present on a movie, whereas GenresAny needs only one of them to be. Zero
+// bounds are unbounded.
+type MovieCriteria struct {
+	Title          string
+	Search         string
+	Genres         []string
+	GenresAny      []string
+	ExcludeGenres  []string
+	YearMin        int32
+	YearMax        int32
+	RuntimeMin     int32
+	RuntimeMax     int32
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	PersonID       int64
+	CollectionID   int64
+	IncludeDeleted bool
+}
+
+func ValidateMovieCriteria(v *validator.Validator, c MovieCriteria) {
+	v.Check(c.YearMin >= 0, "year_min", "must not be negative")
+	v.Check(c.YearMax >= 0, "year_max", "must not be negative")
+	v.Check(c.YearMin == 0 || c.YearMax == 0 || c.YearMin <= c.YearMax, "year_min", "must not be greater than year_max")
+
+	v.Check(c.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(c.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	runtimeOrdered := c.RuntimeMin == 0 || c.RuntimeMax == 0 || c.RuntimeMin <= c.RuntimeMax
+	v.Check(runtimeOrdered, "runtime_min", "must not be greater than runtime_max")
+
+	v.Check(len(c.GenresAny) <= 20, "genres_any", "must not contain more than 20 genres")
+	v.Check(len(c.ExcludeGenres) <= 20, "exclude_genres", "must not contain more than 20 genres")
+
+	createdOrdered := c.CreatedAfter.IsZero() || c.CreatedBefore.IsZero() || c.CreatedAfter.Before(c.CreatedBefore)
+	v.Check(createdOrdered, "created_after", "must be before created_before")
+}
+
+// where returns the WHERE clause condition selecting the movies which meet the criteria. Values are added to args and
+// referenced by their placeholders, so no user input is interpolated into the query.
+func (c MovieCriteria) where(args *queryArgs) string {
+	conditions := []string{"TRUE"}
+
+	// Titles and searches match a movie's localised titles as well as its own.
+	if c.Title != "" {
+		conditions = append(conditions, fmt.Sprintf(
+			`(to_tsvector('simple', movies.title) @@ plainto_tsquery('simple', %[1]s) OR EXISTS (
+				SELECT 1 FROM movie_titles WHERE movie_titles.movie_id = movies.id
+				AND to_tsvector('simple', movie_titles.title) @@ plainto_tsquery('simple', %[1]s)))`,
+			args.add(c.Title),
+		))
+	}
+
+	// A search matches titles which are similar to it word by word, so typos are tolerated, or which contain it, so
+	// partial words match too.
+	if c.Search != "" {
+		conditions = append(conditions, fmt.Sprintf(
+			`(%[1]s <%% movies.title OR movies.title ILIKE %[2]s OR EXISTS (
+				SELECT 1 FROM movie_titles WHERE movie_titles.movie_id = movies.id
+				AND (%[1]s <%% movie_titles.title OR movie_titles.title ILIKE %[2]s)))`,
+			args.add(c.Search), args.add("%"+likeEscaper.Replace(c.Search)+"%"),
+		))
+	}
+
+	if len(c.Genres) > 0 {
+		conditions = append(conditions, fmt.Sprintf("genres @> %s", args.add(pq.Array(c.Genres))))
+	}
+
+	if len(c.GenresAny) > 0 {
+		conditions = append(conditions, fmt.Sprintf("genres && %s", args.add(pq.Array(c.GenresAny))))
+	}
+
+	if len(c.ExcludeGenres) > 0 {
+		conditions = append(conditions, fmt.Sprintf("NOT genres && %s", args.add(pq.Array(c.ExcludeGenres))))
+	}
+
+	if c.YearMin != 0 {
+		conditions = append(conditions, fmt.Sprintf("year >= %s", args.add(c.YearMin)))
+	}
+
+	if c.YearMax != 0 {
+		conditions = append(conditions, fmt.Sprintf("year <= %s", args.add(c.YearMax)))
+	}
+
+	if c.RuntimeMin != 0 {
+		conditions = append(conditions, fmt.Sprintf("runtime >= %s", args.add(c.RuntimeMin)))
+	}
+
+	if c.RuntimeMax != 0 {
+		conditions = append(conditions, fmt.Sprintf("runtime <= %s", args.add(c.RuntimeMax)))
+	}
+
+	if !c.CreatedAfter.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at > %s", args.add(c.CreatedAfter)))
+	}
+
+	if !c.CreatedBefore.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at < %s", args.add(c.CreatedBefore)))
+	}
+
+	if c.PersonID != 0 {
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM movie_credits WHERE movie_credits.movie_id = movies.id AND movie_credits.person_id = %s)",
+			args.add(c.PersonID),
+		))
+	}
+
+	if c.CollectionID != 0 {
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM collection_movies WHERE collection_movies.movie_id = movies.id AND collection_movies.collection_id = %s)",
+			args.add(c.CollectionID),
+		))
+	}
+
+	if !c.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// relevance returns the expression scoring how well the best of a movie's titles matches the search, between 0 and 1.
+// Without a search every movie scores 0.
+func (c MovieCriteria) relevance(args *queryArgs) string {
+	if c.Search == "" {
+		return "0::double precision"
+	}
+	return fmt.Sprintf(
+		`GREATEST(word_similarity(%[1]s, movies.title), (
+			SELECT max(word_similarity(%[1]s, movie_titles.title)) FROM movie_titles
+			WHERE movie_titles.movie_id = movies.id))::double precision`,
+		args.add(c.Search),
+	)
+}
+
+// likeEscaper escapes the characters which have a special meaning in a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// GetAll returns the page of movies meeting the criteria. Only the fields named are read, along with the id and sort
+// column; if none are named the whole movie is read.
+func (m MovieModel) GetAll(criteria MovieCriteria, filters Filters, fields []string) ([]*Movie, Metadata, error) {
+	if filters.Cursor != nil {
+		return m.getAllByCursor(criteria, filters, fields)
+	}
+
+	var args queryArgs
+
+	columns, dests := movieSelection(fields, filters)
+
+	// The relevance is computed in a lateral subquery so it can be referred to by name when sorting on it.
+	query := fmt.Sprintf(
+		`SELECT count(*) OVER(), %s
+			  FROM movies, LATERAL (SELECT %s AS relevance) AS search
+			  WHERE %s
+			  ORDER BY %s
+			  LIMIT %s OFFSET %s`, columns, criteria.relevance(&args), criteria.where(&args), filters.orderBy(),
+		args.add(filters.limit()), args.add(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
+	defer rows.Close()
 
 	totalRecords := 0
 	var movies []*Movie
 
+	for rows.Next() {
+		var movie Movie
+
+		err = rows.Scan(append([]any{&totalRecords}, dests(&movie)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	// Hand out cursors alongside the page numbers so clients can switch to keyset pagination from any page.
+	if len(movies) > 0 {
+		if filters.Page > 1 {
+			metadata.PrevCursor = movieCursor(movies[0], filters, true)
+		}
+		if filters.offset()+len(movies) < totalRecords {
+			metadata.NextCursor = movieCursor(movies[len(movies)-1], filters, false)
+		}
+	}
+
+	return movies, metadata, nil
+}
+
+// getAllByCursor returns the page of movies either side of filters.Cursor. Rows are selected with a keyset condition
+// on the sort column and id, so the query cost doesn't grow with the depth of the page and rows inserted while the
+// client is paging don't shift the results. One extra row is read to find out whether another page follows.
+func (m MovieModel) getAllByCursor(criteria MovieCriteria, filters Filters, fields []string) ([]*Movie, Metadata, error) {
+	var args queryArgs
+
+	columns, dests := movieSelection(fields, filters)
+
+	query := fmt.Sprintf(
+		`SELECT %s
+			  FROM movies, LATERAL (SELECT %s AS relevance) AS search
+			  WHERE %s
+			  AND %s
+			  ORDER BY %s
+			  LIMIT %s`, columns, criteria.relevance(&args), criteria.where(&args), filters.keysetCondition(&args), filters.orderBy(),
+		args.add(filters.limit()+1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var movies []*Movie
+
+	for rows.Next() {
+		var movie Movie
+
+		err = rows.Scan(dests(&movie)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	hasMore := len(movies) > filters.limit()
+	if hasMore {
+		movies = movies[:filters.limit()]
+	}
+
+	// Rows read backwards from the cursor come out in reverse, so put them back into the requested order.
+	if filters.backward() {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+
+	if len(movies) > 0 {
+		if !filters.backward() || hasMore {
+			metadata.PrevCursor = movieCursor(movies[0], filters, true)
+		}
+		if filters.backward() || hasMore {
+			metadata.NextCursor = movieCursor(movies[len(movies)-1], filters, false)
+		}
+	}
+
+	return movies, metadata, nil
+}
+
+// Export calls fn with each movie meeting the criteria, in id order. Movies are handed to fn as their rows are read
+// rather than being collected first, so the whole catalogue can be exported without holding it in memory. Iteration
+// stops at the first error returned by fn, or when ctx is cancelled.
+func (m MovieModel) Export(ctx context.Context, criteria MovieCriteria, fn func(*Movie) error) error {
+	var args queryArgs
+
+	query := fmt.Sprintf(`SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count
+			  FROM movies
+			  WHERE %s
+			  ORDER BY id ASC`, criteria.where(&args))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
 	for rows.Next() {
 		var movie Movie
 
 		err = rows.Scan(
-			&totalRecords,
 			&movie.ID,
 			&movie.CreatedAt,
 			&movie.Title,
@@ -193,19 +1256,42 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
 		)
 		if err != nil {
-			return nil, Metadata{}, err
+			return err
 		}
 
-		movies = append(movies, &movie)
-	}
-	err = rows.Err()
-	if err != nil {
-		return nil, Metadata{}, err
+		err = fn(&movie)
+		if err != nil {
+			return err
+		}
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return rows.Err()
+}
 
-	return movies, metadata, nil
+// movieCursor returns an encoded cursor positioned at the movie for the sort in filters.
+func movieCursor(movie *Movie, filters Filters, backward bool) string {
+	var value string
+
+	switch filters.sortColumn() {
+	case "title":
+		value = movie.Title
+	case "year":
+		value = strconv.FormatInt(int64(movie.Year), 10)
+	case "runtime":
+		value = strconv.FormatInt(int64(movie.Runtime), 10)
+	case "average_rating":
+		value = strconv.FormatFloat(movie.AverageRating, 'f', -1, 64)
+	case "rating_count":
+		value = strconv.FormatInt(int64(movie.RatingCount), 10)
+	case "relevance":
+		value = strconv.FormatFloat(movie.Score, 'f', -1, 64)
+	default:
+		value = strconv.FormatInt(movie.ID, 10)
+	}
+
+	return Cursor{Sort: filters.Sort, Value: value, ID: movie.ID, Backward: backward}.Encode()
 }
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Poster records where a movie's poster image and its thumbnail are kept in the blob store.
+type Poster struct {
+	MovieID      int64
+	Key          string
+	ContentType  string
+	ThumbnailKey string
+	Width        int
+	Height       int
+	UpdatedAt    time.Time
+}
+
+// ========================= POSTER DATABASE MODEL =======================================
+
+type PosterModel struct {
+	DB *sql.DB
+}
+
+func (m PosterModel) Get(movieID int64) (*Poster, error) {
+	query := `SELECT movie_id, key, content_type, thumbnail_key, width, height, updated_at
+			  FROM movie_posters
+			  WHERE movie_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var poster Poster
+
+	err := m.DB.QueryRowContext(ctx, query, movieID).Scan(
+		&poster.MovieID,
+		&poster.Key,
+		&poster.ContentType,
+		&poster.ThumbnailKey,
+		&poster.Width,
+		&poster.Height,
+		&poster.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &poster, nil
+}
+
+// Set records the movie's new poster and saves the movie's PosterURL, bumping its version as the poster is part of its
+// representation. The poster it replaced, if any, is returned so its images can be removed from the blob store.
+// ErrRecordNotFound is returned if the movie doesn't exist.
+func (m PosterModel) Set(poster *Poster, movie *Movie) (*Poster, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE movies
+			  SET poster_url = $1, version = version + 1
+			  WHERE id = $2 AND deleted_at IS NULL
+			  RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, movie.PosterURL, poster.MovieID).Scan(&movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `SELECT key, content_type, thumbnail_key
+			  FROM movie_posters
+			  WHERE movie_id = $1
+			  FOR UPDATE`
+
+	previous := &Poster{MovieID: poster.MovieID}
+
+	err = tx.QueryRowContext(ctx, query, poster.MovieID).Scan(&previous.Key, &previous.ContentType, &previous.ThumbnailKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			previous = nil
+		default:
+			return nil, err
+		}
+	}
+
+	query = `INSERT INTO movie_posters (movie_id, key, content_type, thumbnail_key, width, height)
+			 VALUES ($1, $2, $3, $4, $5, $6)
+			 ON CONFLICT (movie_id) DO UPDATE
+			 SET key = EXCLUDED.key, content_type = EXCLUDED.content_type, thumbnail_key = EXCLUDED.thumbnail_key,
+			 width = EXCLUDED.width, height = EXCLUDED.height, updated_at = NOW()
+			 RETURNING updated_at`
+
+	args := []any{poster.MovieID, poster.Key, poster.ContentType, poster.ThumbnailKey, poster.Width, poster.Height}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&poster.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return previous, nil
+}
+
+// removePoster drops the movie's poster as part of the transaction tx, clearing its PosterURL. The poster is returned
+// so its images can be removed from the blob store, or nil if the movie didn't have one.
+func removePoster(ctx context.Context, tx *sql.Tx, movieID int64) (*Poster, error) {
+	_, err := tx.ExecContext(ctx, `UPDATE movies SET poster_url = '' WHERE id = $1`, movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `DELETE FROM movie_posters
+			  WHERE movie_id = $1
+			  RETURNING movie_id, key, content_type, thumbnail_key, width, height, updated_at`
+
+	var poster Poster
+
+	err = tx.QueryRowContext(ctx, query, movieID).Scan(
+		&poster.MovieID,
+		&poster.Key,
+		&poster.ContentType,
+		&poster.ThumbnailKey,
+		&poster.Width,
+		&poster.Height,
+		&poster.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &poster, nil
+}
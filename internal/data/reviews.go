@@ -0,0 +1,261 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"richwynmorris.co.uk/internal/validator"
+)
+
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+)
+
+type Review struct {
+	ID        int64     `json:"id"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	UserName  string    `json:"user_name,omitempty"`
+	Score     int32     `json:"score"`
+	Body      string    `json:"body,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int32     `json:"version"`
+}
+
+// ===================== REVIEW VALIDATION ===============================
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Score >= 1, "score", "score must be at least 1")
+	v.Check(review.Score <= 10, "score", "score must not be more than 10")
+
+	v.Check(len(review.Body) <= 10_000, "body", "body must not be more than 10,000 bytes long")
+}
+
+// ========================= REVIEW DATABASE MODEL =======================================
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a review and updates the movie's rating to include it. A user can only review each movie once, so
+// ErrDuplicateReview is returned if they already have.
+func (m ReviewModel) Insert(review *Review) error {
+	query := `INSERT INTO reviews (user_id, movie_id, score, body)
+			  VALUES ($1, $2, $3, $4)
+			  RETURNING id, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []any{review.UserID, review.MovieID, review.Score, review.Body}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_movie_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	err = updateMovieRating(ctx, tx, review.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetForUser returns the review the user has written of the movie.
+func (m ReviewModel) GetForUser(movieID, userID int64) (*Review, error) {
+	query := `SELECT reviews.id, reviews.movie_id, reviews.user_id, users.name, reviews.score, reviews.body,
+			  reviews.created_at, reviews.updated_at, reviews.version
+			  FROM reviews
+			  INNER JOIN users ON users.id = reviews.user_id
+			  WHERE reviews.movie_id = $1 AND reviews.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var review Review
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, userID).Scan(
+		&review.ID,
+		&review.MovieID,
+		&review.UserID,
+		&review.UserName,
+		&review.Score,
+		&review.Body,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+// Update saves the review if its version still matches the database, and updates the movie's rating.
+func (m ReviewModel) Update(review *Review) error {
+	query := `UPDATE reviews
+			  SET score = $1, body = $2, updated_at = NOW(), version = version + 1
+			  WHERE id = $3 AND version = $4
+			  RETURNING updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []any{review.Score, review.Body, review.ID, review.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = updateMovieRating(ctx, tx, review.MovieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteForUser removes the user's review of the movie and updates the movie's rating.
+func (m ReviewModel) DeleteForUser(movieID, userID int64) error {
+	query := `DELETE FROM reviews
+			  WHERE movie_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	resp, err := tx.ExecContext(ctx, query, movieID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsDeleted, err := resp.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsDeleted == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = updateMovieRating(ctx, tx, movieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ReviewModel) GetAllForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+			  SELECT count(*) OVER(), id, movie_id, user_id, (SELECT name FROM users WHERE users.id = reviews.user_id),
+			  score, body, created_at, updated_at, version
+			  FROM reviews
+			  WHERE movie_id = $1
+			  ORDER BY %s
+			  LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err = rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.MovieID,
+			&review.UserID,
+			&review.UserName,
+			&review.Score,
+			&review.Body,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return reviews, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// updateMovieRating recalculates the movie's average rating and rating count from its reviews, as part of the
+// transaction which changed them. The movie's version is bumped if the rating changed, so that its entity tag changes
+// with it and clients holding the old rating don't have it confirmed as current. No revision is recorded, as the
+// rating isn't part of the movie's editable state.
+func updateMovieRating(ctx context.Context, tx *sql.Tx, movieID int64) error {
+	// Lock the movie first so that concurrent reviews of it are counted one after another, each seeing the last.
+	_, err := tx.ExecContext(ctx, `SELECT id FROM movies WHERE id = $1 FOR UPDATE`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE movies
+			  SET average_rating = ratings.average, rating_count = ratings.count, version = version + 1
+			  FROM (
+				  SELECT COALESCE(ROUND(AVG(score), 2), 0) AS average, count(*) AS count
+				  FROM reviews
+				  WHERE movie_id = $1
+			  ) AS ratings
+			  WHERE movies.id = $1
+			  AND (movies.average_rating, movies.rating_count) IS DISTINCT FROM (ratings.average, ratings.count)`
+
+	_, err = tx.ExecContext(ctx, query, movieID)
+	return err
+}
@@ -0,0 +1,195 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+// MovieRevision is a snapshot of a movie taken each time it's written, along with who made the change and which
+// fields changed.
+type MovieRevision struct {
+	MovieID   int64           `json:"movie_id"`
+	Version   int32           `json:"version"`
+	Action    string          `json:"action"`
+	UserID    *int64          `json:"user_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Movie     Movie           `json:"movie"`
+	Changes   json.RawMessage `json:"changes"`
+}
+
+// FieldChange holds the value of a movie field before and after a revision.
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// diffMovies returns the fields that differ between two versions of a movie. A nil before is treated as the movie not
+// existing yet, so every field is reported.
+func diffMovies(before, after *Movie) map[string]FieldChange {
+	fields := func(movie *Movie) map[string]any {
+		if movie == nil {
+			return map[string]any{}
+		}
+		fields := map[string]any{"title": movie.Title, "year": movie.Year, "runtime": movie.Runtime, "genres": movie.Genres}
+		if movie.DeletedAt != nil {
+			fields["deleted_at"] = *movie.DeletedAt
+		}
+		if len(movie.ExternalIDs) > 0 {
+			fields["external_ids"] = movie.ExternalIDs
+		}
+		return fields
+	}
+
+	from, to := fields(before), fields(after)
+	changes := make(map[string]FieldChange)
+
+	for _, name := range []string{"title", "year", "runtime", "genres", "deleted_at", "external_ids"} {
+		if reflect.DeepEqual(from[name], to[name]) {
+			continue
+		}
+		changes[name] = FieldChange{From: from[name], To: to[name]}
+	}
+
+	return changes
+}
+
+// insertRevision records a snapshot of after as part of the transaction that wrote it, along with the fields that
+// changed since before.
+func insertRevision(ctx context.Context, tx *sql.Tx, action string, before, after *Movie, userID int64) error {
+	changes, err := json.Marshal(diffMovies(before, after))
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_revisions (movie_id, version, action, user_id, title, year, runtime, genres, external_ids,
+			  changes)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	args := []any{
+		after.ID,
+		after.Version,
+		action,
+		sql.NullInt64{Int64: userID, Valid: userID > 0},
+		after.Title,
+		after.Year,
+		after.Runtime,
+		pq.Array(after.Genres),
+		after.ExternalIDs,
+		changes,
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ========================= REVISION DATABASE MODEL =======================================
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+func (m RevisionModel) GetAllForMovie(movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := fmt.Sprintf(`
+			  SELECT count(*) OVER(), movie_id, version, action, user_id, created_at, title, year, runtime, genres,
+			  external_ids, changes
+			  FROM movie_revisions
+			  WHERE movie_id = $1
+			  ORDER BY %s
+			  LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		var revision MovieRevision
+
+		err = rows.Scan(append([]any{&totalRecords}, revision.dest()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revision.fill()
+		revisions = append(revisions, &revision)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return revisions, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m RevisionModel) Get(movieID int64, version int32) (*MovieRevision, error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT movie_id, version, action, user_id, created_at, title, year, runtime, genres, external_ids, changes
+			  FROM movie_revisions
+			  WHERE movie_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var revision MovieRevision
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(revision.dest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	revision.fill()
+
+	return &revision, nil
+}
+
+// dest returns the scan destinations for the columns selected by the revision queries.
+func (r *MovieRevision) dest() []any {
+	return []any{
+		&r.MovieID,
+		&r.Version,
+		&r.Action,
+		&r.UserID,
+		&r.CreatedAt,
+		&r.Movie.Title,
+		&r.Movie.Year,
+		&r.Movie.Runtime,
+		pq.Array(&r.Movie.Genres),
+		&r.Movie.ExternalIDs,
+		(*[]byte)(&r.Changes),
+	}
+}
+
+// fill copies the revision's identifiers onto its movie snapshot.
+func (r *MovieRevision) fill() {
+	r.Movie.ID = r.MovieID
+	r.Movie.Version = r.Version
+}
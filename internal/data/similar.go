@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The weights given to each signal when scoring how similar two movies are. They add up to 1, so similarity is
+// between 0 and 1.
+const (
+	genreWeight    = 0.5
+	yearWeight     = 0.2
+	coRatingWeight = 0.3
+)
+
+const (
+	// yearWindow is the number of years apart at which two movies stop counting as being from the same era.
+	yearWindow = 20
+	// coRatingCap is the number of co-ratings at which the co-rating signal is at its strongest.
+	coRatingCap = 10
+	// likedScore is the lowest review score counted as liking a movie.
+	likedScore = 7
+)
+
+// SimilarMovie is a movie recommended as being like another one, with the signals it was scored on.
+type SimilarMovie struct {
+	Movie          *Movie   `json:"movie"`
+	Similarity     float64  `json:"similarity"`
+	SharedGenres   []string `json:"shared_genres"`
+	YearDifference int32    `json:"year_difference"`
+	CoRatings      int      `json:"co_ratings"`
+	Explanation    string   `json:"explanation"`
+}
+
+// explain describes in words why the movie was recommended.
+func (s *SimilarMovie) explain() string {
+	var reasons []string
+
+	if len(s.SharedGenres) > 0 {
+		reasons = append(reasons, "shares the genres "+strings.Join(s.SharedGenres, ", "))
+	}
+
+	switch {
+	case s.YearDifference == 0:
+		reasons = append(reasons, "released the same year")
+	case s.YearDifference == 1:
+		reasons = append(reasons, "released a year apart")
+	case s.YearDifference < yearWindow:
+		reasons = append(reasons, fmt.Sprintf("released %d years apart", s.YearDifference))
+	}
+
+	switch {
+	case s.CoRatings == 1:
+		reasons = append(reasons, "liked by a reviewer who also liked this movie")
+	case s.CoRatings > 1:
+		reasons = append(reasons, fmt.Sprintf("liked by %d reviewers who also liked this movie", s.CoRatings))
+	}
+
+	if len(reasons) == 0 {
+		return ""
+	}
+
+	explanation := strings.Join(reasons, "; ")
+	return strings.ToUpper(explanation[:1]) + explanation[1:]
+}
+
+// Similar returns the page of movies most like the one given. Movies are scored on the overlap of their genres with
+// the movie's, how close together they were released, and how many reviewers liked both. Only movies sharing a genre
+// or a reviewer who liked both are considered, so the genre condition can use the GIN index on genres.
+func (m MovieModel) Similar(movie *Movie, filters Filters) ([]*SimilarMovie, Metadata, error) {
+	query := fmt.Sprintf(
+		`WITH co_ratings AS (
+				  SELECT theirs.movie_id, count(*) AS count
+				  FROM reviews AS ours
+				  INNER JOIN reviews AS theirs ON theirs.user_id = ours.user_id AND theirs.movie_id <> ours.movie_id
+				  WHERE ours.movie_id = $1 AND ours.score >= $4 AND theirs.score >= $4
+				  GROUP BY theirs.movie_id
+			  )
+			  SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, deleted_at, average_rating,
+			  rating_count, external_ids, poster_url, similarity, shared_genres, year_difference, co_ratings
+			  FROM (
+				  SELECT movies.*, shared.genres AS shared_genres, abs(movies.year - $2) AS year_difference,
+				  COALESCE(co_ratings.count, 0) AS co_ratings,
+				  round((
+					  $5 * cardinality(shared.genres)::numeric
+						  / GREATEST(cardinality(movies.genres) + cardinality($3::text[]) - cardinality(shared.genres), 1)
+					  + $6 * GREATEST(1 - abs(movies.year - $2)::numeric / $8, 0)
+					  + $7 * LEAST(COALESCE(co_ratings.count, 0), $9)::numeric / $9
+				  ), 3)::double precision AS similarity
+				  FROM movies
+				  LEFT JOIN co_ratings ON co_ratings.movie_id = movies.id,
+				  LATERAL (
+					  SELECT ARRAY(SELECT unnest(movies.genres) INTERSECT SELECT unnest($3::text[]) ORDER BY 1) AS genres
+				  ) AS shared
+				  WHERE movies.id <> $1
+				  AND movies.deleted_at IS NULL
+				  AND (movies.genres && $3::text[] OR co_ratings.movie_id IS NOT NULL)
+			  ) AS candidates
+			  ORDER BY %s
+			  LIMIT $10 OFFSET $11`, filters.orderBy())
+
+	args := []any{
+		movie.ID, movie.Year, pq.Array(movie.Genres), likedScore,
+		genreWeight, yearWeight, coRatingWeight, yearWindow, coRatingCap,
+		filters.limit(), filters.offset(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	similar := []*SimilarMovie{}
+
+	for rows.Next() {
+		var candidate Movie
+		var item SimilarMovie
+
+		err = rows.Scan(
+			&totalRecords,
+			&candidate.ID,
+			&candidate.CreatedAt,
+			&candidate.Title,
+			&candidate.Year,
+			&candidate.Runtime,
+			pq.Array(&candidate.Genres),
+			&candidate.Version,
+			&candidate.DeletedAt,
+			&candidate.AverageRating,
+			&candidate.RatingCount,
+			&candidate.ExternalIDs,
+			&candidate.PosterURL,
+			&item.Similarity,
+			pq.Array(&item.SharedGenres),
+			&item.YearDifference,
+			&item.CoRatings,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		item.Movie = &candidate
+		item.Explanation = item.explain()
+
+		similar = append(similar, &item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return similar, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
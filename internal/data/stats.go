@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieStats summarises the catalogue of movies which haven't been deleted.
+type MovieStats struct {
+	TotalMovies     int          `json:"total_movies"`
+	AverageRuntime  float64      `json:"average_runtime"`
+	Genres          []FacetCount `json:"genres"`
+	Years           []FacetCount `json:"years"`
+	NewestAdditions []*Movie     `json:"newest_additions"`
+	GeneratedAt     time.Time    `json:"generated_at"`
+}
+
+// newestAdditionsLimit is the number of recently added movies included in the stats.
+const newestAdditionsLimit = 10
+
+// Stats computes the catalogue statistics. The queries run in a single read only snapshot, so the figures agree with
+// each other even while movies are being written.
+func (m MovieModel) Stats() (*MovieStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stats := MovieStats{GeneratedAt: time.Now()}
+
+	query := `SELECT count(*), COALESCE(ROUND(AVG(runtime), 1), 0)
+			  FROM movies
+			  WHERE deleted_at IS NULL`
+
+	err = tx.QueryRowContext(ctx, query).Scan(&stats.TotalMovies, &stats.AverageRuntime)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT genre, count(*)
+			  FROM movies, unnest(genres) AS genre
+			  WHERE deleted_at IS NULL
+			  GROUP BY genre
+			  ORDER BY count(*) DESC, genre ASC`
+
+	stats.Genres, err = queryCounts(ctx, tx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT year::text, count(*)
+			  FROM movies
+			  WHERE deleted_at IS NULL
+			  GROUP BY year
+			  ORDER BY year ASC`
+
+	stats.Years, err = queryCounts(ctx, tx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT id, created_at, title, year, runtime, genres, version, average_rating, rating_count
+			  FROM movies
+			  WHERE deleted_at IS NULL
+			  ORDER BY created_at DESC, id DESC
+			  LIMIT $1`
+
+	rows, err := tx.QueryContext(ctx, query, newestAdditionsLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats.NewestAdditions = []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err = rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		stats.NewestAdditions = append(stats.NewestAdditions, &movie)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// queryCounts runs a query selecting value and count pairs.
+func queryCounts(ctx context.Context, tx *sql.Tx, query string) ([]FacetCount, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []FacetCount{}
+
+	for rows.Next() {
+		var count FacetCount
+
+		err = rows.Scan(&count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
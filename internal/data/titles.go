@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"richwynmorris.co.uk/internal/validator"
+)
+
+// LocaleRX matches the locales titles can be given in: a language code, optionally followed by a region, e.g. "fr"
+// or "pt-BR".
+var LocaleRX = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// MovieTitle is the title a movie goes by in a locale. IsOriginal marks the title it was released under.
+type MovieTitle struct {
+	Locale     string `json:"locale"`
+	Title      string `json:"title"`
+	IsOriginal bool   `json:"is_original"`
+}
+
+// BestTitle returns the title which best suits the locales, which are in order of preference. For each locale in
+// turn, a title in exactly that locale is preferred, then one in the same language. false is returned if none match.
+func BestTitle(titles []MovieTitle, locales []string) (MovieTitle, bool) {
+	for _, locale := range locales {
+		for _, title := range titles {
+			if strings.EqualFold(title.Locale, locale) {
+				return title, true
+			}
+		}
+
+		language, _, _ := strings.Cut(locale, "-")
+
+		for _, title := range titles {
+			titleLanguage, _, _ := strings.Cut(title.Locale, "-")
+			if strings.EqualFold(titleLanguage, language) {
+				return title, true
+			}
+		}
+	}
+
+	return MovieTitle{}, false
+}
+
+// ===================== TITLE VALIDATION ===============================
+
+func ValidateMovieTitles(v *validator.Validator, titles []MovieTitle) {
+	locales := make([]string, len(titles))
+	originals := 0
+
+	for i, title := range titles {
+		field := fmt.Sprintf("titles[%d]", i)
+
+		v.Check(validator.Matches(title.Locale, LocaleRX), field+".locale", "must be a locale such as fr or pt-BR")
+		v.Check(title.Title != "", field+".title", "must be provided")
+		v.Check(len(title.Title) <= 500, field+".title", "must not be more than 500 bytes long")
+
+		locales[i] = title.Locale
+		if title.IsOriginal {
+			originals++
+		}
+	}
+
+	v.Check(validator.Unique(locales), "titles", "must not contain more than one title per locale")
+	v.Check(originals <= 1, "titles", "must not contain more than one original title")
+}
+
+// ========================= TITLE DATABASE MODEL =======================================
+
+type MovieTitleModel struct {
+	DB *sql.DB
+}
+
+// GetAllForMovie returns the movie's titles in locale order.
+func (m MovieTitleModel) GetAllForMovie(movieID int64) ([]MovieTitle, error) {
+	titles, err := m.GetAllForMovies([]int64{movieID})
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]MovieTitle{}, titles[movieID]...), nil
+}
+
+// GetAllForMovies returns the titles of each of the movies, keyed by movie id, in locale order. Movies without titles
+// are left out of the map.
+func (m MovieTitleModel) GetAllForMovies(movieIDs []int64) (map[int64][]MovieTitle, error) {
+	query := `SELECT movie_id, locale, title, is_original
+			  FROM movie_titles
+			  WHERE movie_id = ANY($1)
+			  ORDER BY locale`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := make(map[int64][]MovieTitle)
+
+	for rows.Next() {
+		var movieID int64
+		var title MovieTitle
+
+		err = rows.Scan(&movieID, &title.Locale, &title.Title, &title.IsOriginal)
+		if err != nil {
+			return nil, err
+		}
+
+		titles[movieID] = append(titles[movieID], title)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return titles, nil
+}
+
+// ReplaceForMovie swaps the movie's titles for the ones given, in a single transaction, and bumps the movie's version
+// as its localised representations are built from them.
+func (m MovieTitleModel) ReplaceForMovie(movieID int64, titles []MovieTitle) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM movie_titles WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO movie_titles (movie_id, locale, title, is_original)
+			  VALUES ($1, $2, $3, $4)`
+
+	for _, title := range titles {
+		_, err = tx.ExecContext(ctx, query, movieID, title.Locale, title.Title, title.IsOriginal)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = touchMovie(ctx, tx, movieID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -14,6 +14,8 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeEmailChange    = "email-change"
+	ScopePasswordReset  = "password-reset"
 )
 
 type Token struct {
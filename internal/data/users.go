@@ -18,14 +18,17 @@ var (
 
 var AnonymousUser = &User{}
 
+// User is an account holder. PendingEmail is an address the user has asked to change their email to, which doesn't
+// take effect until it has been confirmed.
 type User struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	PendingEmail string    `json:"pending_email,omitempty"`
+	Password     password  `json:"-"`
+	Activated    bool      `json:"activated"`
+	Version      int       `json:"-"`
 }
 
 // ========================= USER VALIDATION ================================
@@ -125,7 +128,7 @@ func (m UserModel) Insert(user *User) error {
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-			SELECT id, created_at, name, email, password_hash, activated, version
+			SELECT id, created_at, name, email, password_hash, activated, COALESCE(pending_email, ''), version
 			FROM users
 			WHERE email = $1
 			`
@@ -142,6 +145,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.PendingEmail,
 		&user.Version,
 	)
 
@@ -160,7 +164,8 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
 			 UPDATE users
-			 SET name = $1, email = $2, password_hash = $3, activated = $4, id = $5, version = $6
+			 SET name = $1, email = $2, password_hash = $3, activated = $4, pending_email = NULLIF($7, ''),
+			 version = version + 1
  			 WHERE id = $5 AND version = $6
 			 RETURNING version
 			`
@@ -169,7 +174,7 @@ func (m UserModel) Update(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.ID, user.Version}
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.ID, user.Version, user.PendingEmail}
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
@@ -186,12 +191,74 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
+// Delete removes the user along with their tokens, permissions, reviews and watchlist. The ratings of the movies they
+// reviewed are recalculated without their reviews in the same transaction.
+func (m UserModel) Delete(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT movie_id FROM reviews WHERE user_id = $1 ORDER BY movie_id`, id)
+	if err != nil {
+		return err
+	}
+
+	var reviewed []int64
+
+	for rows.Next() {
+		var movieID int64
+
+		err = rows.Scan(&movieID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		reviewed = append(reviewed, movieID)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	resp, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsDeleted, err := resp.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsDeleted == 0 {
+		return ErrRecordNotFound
+	}
+
+	for _, movieID := range reviewed {
+		err = updateMovieRating(ctx, tx, movieID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (m UserModel) GetForToken(tokenScope, tokenPlainText string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
 
 	// Set up the SQL query.
 	query := `
-			  SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version FROM users
+			  SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated,
+			  COALESCE(users.pending_email, ''), users.version
+			  FROM users
 			  INNER JOIN tokens
 			  ON users.id = tokens.user_id
 			  WHERE tokens.hash = $1
@@ -212,6 +279,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlainText string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.PendingEmail,
 		&user.Version,
 	)
 
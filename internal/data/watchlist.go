@@ -0,0 +1,166 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"richwynmorris.co.uk/internal/validator"
+)
+
+var (
+	ErrDuplicateWatchlistItem = errors.New("duplicate watchlist item")
+)
+
+// WatchlistItem is a movie on a user's watchlist. WatchedAt is nil until the user marks the movie as watched.
+type WatchlistItem struct {
+	Movie     *Movie     `json:"movie"`
+	AddedAt   time.Time  `json:"added_at"`
+	WatchedAt *time.Time `json:"watched_at"`
+}
+
+// ===================== WATCHLIST VALIDATION ===============================
+
+func ValidateWatchedAt(v *validator.Validator, watchedAt time.Time) {
+	v.Check(!watchedAt.After(time.Now()), "watched_at", "must not be in the future")
+}
+
+// ========================= WATCHLIST DATABASE MODEL =======================================
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+// Insert adds the movie to the user's watchlist. ErrDuplicateWatchlistItem is returned if it's already there.
+func (m WatchlistModel) Insert(userID, movieID int64) (*WatchlistItem, error) {
+	query := `INSERT INTO watchlist_items (user_id, movie_id)
+			  VALUES ($1, $2)
+			  RETURNING added_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var item WatchlistItem
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(&item.AddedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "watchlist_items_pkey"`:
+			return nil, ErrDuplicateWatchlistItem
+		default:
+			return nil, err
+		}
+	}
+
+	return &item, nil
+}
+
+// SetWatched records when the user watched a movie on their watchlist, or clears it if watchedAt is nil.
+func (m WatchlistModel) SetWatched(userID, movieID int64, watchedAt *time.Time) error {
+	query := `UPDATE watchlist_items
+			  SET watched_at = $1
+			  WHERE user_id = $2 AND movie_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	resp, err := m.DB.ExecContext(ctx, query, watchedAt, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsUpdated, err := resp.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsUpdated == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m WatchlistModel) Delete(userID, movieID int64) error {
+	query := `DELETE FROM watchlist_items
+			  WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	resp, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsDeleted, err := resp.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsDeleted == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForUser returns a page of the user's watchlist. If watched is not nil, only movies which have (or haven't)
+// been watched are returned. Movies which have been deleted are left out.
+func (m WatchlistModel) GetAllForUser(userID int64, watched *bool, filters Filters) ([]*WatchlistItem, Metadata, error) {
+	query := fmt.Sprintf(`
+			  SELECT count(*) OVER(), watchlist_items.added_at, watchlist_items.watched_at, movies.id, movies.created_at,
+			  movies.title, movies.year, movies.runtime, movies.genres, movies.version, movies.average_rating,
+			  movies.rating_count
+			  FROM watchlist_items
+			  INNER JOIN movies ON movies.id = watchlist_items.movie_id
+			  WHERE watchlist_items.user_id = $1
+			  AND movies.deleted_at IS NULL
+			  AND ($2::boolean IS NULL OR (watchlist_items.watched_at IS NOT NULL) = $2)
+			  ORDER BY %s
+			  LIMIT $3 OFFSET $4`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, watched, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*WatchlistItem{}
+
+	for rows.Next() {
+		item := WatchlistItem{Movie: &Movie{}}
+
+		err = rows.Scan(
+			&totalRecords,
+			&item.AddedAt,
+			&item.WatchedAt,
+			&item.Movie.ID,
+			&item.Movie.CreatedAt,
+			&item.Movie.Title,
+			&item.Movie.Year,
+			&item.Movie.Runtime,
+			pq.Array(&item.Movie.Genres),
+			&item.Movie.Version,
+			&item.Movie.AverageRating,
+			&item.Movie.RatingCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		items = append(items, &item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return items, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL,
+    version integer NOT NULL,
+    action text NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    year integer NOT NULL,
+    runtime integer NOT NULL,
+    genres text[] NOT NULL,
+    changes jsonb NOT NULL DEFAULT '{}',
+    UNIQUE (movie_id, version)
+);
+
+-- Record the current state of existing movies as their first revision.
+INSERT INTO movie_revisions (movie_id, version, action, created_at, title, year, runtime, genres)
+SELECT id, version, 'insert', created_at, title, year, runtime, genres FROM movies;
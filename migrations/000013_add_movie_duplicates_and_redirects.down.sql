@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS movie_redirects;
+
+DROP INDEX IF EXISTS movies_normalised_title_year_idx;
@@ -0,0 +1,13 @@
+-- Supports the duplicate check on create, which compares titles ignoring case, spacing and punctuation.
+CREATE INDEX IF NOT EXISTS movies_normalised_title_year_idx ON movies (lower(regexp_replace(title, '[^[:alnum:]]+', '', 'g')), year)
+WHERE deleted_at IS NULL;
+
+-- When a duplicate movie is merged into another, its old id is kept here so requests for it can be redirected. old_id
+-- isn't a foreign key, as the merged movie is eventually purged.
+CREATE TABLE IF NOT EXISTS movie_redirects (
+    old_id bigint PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS movie_redirects_movie_id_idx ON movie_redirects (movie_id);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS movie_titles (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    locale text NOT NULL,
+    title text NOT NULL,
+    is_original boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (movie_id, locale)
+);
+
+-- A movie has at most one original title.
+CREATE UNIQUE INDEX IF NOT EXISTS movie_titles_original_idx ON movie_titles (movie_id) WHERE is_original;
+
+-- Alternate titles are searched alongside the movie's own title, so index them the same way.
+CREATE INDEX IF NOT EXISTS movie_titles_title_idx ON movie_titles USING GIN (to_tsvector('simple', title));
+CREATE INDEX IF NOT EXISTS movie_titles_title_trgm_idx ON movie_titles USING GIN (title gin_trgm_ops);
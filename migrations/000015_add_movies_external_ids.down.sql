@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS movies_external_ids_eidr_idx;
+DROP INDEX IF EXISTS movies_external_ids_tmdb_idx;
+DROP INDEX IF EXISTS movies_external_ids_imdb_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS external_ids;
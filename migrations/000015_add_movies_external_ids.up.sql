@@ -0,0 +1,6 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS external_ids jsonb NOT NULL DEFAULT '{}';
+
+-- Each external id identifies at most one movie.
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_imdb_idx ON movies ((external_ids->>'imdb'));
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_tmdb_idx ON movies ((external_ids->>'tmdb'));
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_eidr_idx ON movies ((external_ids->>'eidr'));
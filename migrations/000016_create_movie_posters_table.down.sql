@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS movie_posters;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS poster_url;
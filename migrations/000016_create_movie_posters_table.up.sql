@@ -0,0 +1,13 @@
+-- poster_url is kept on the movie so it can be read along with the rest of it. The keys of the stored images are kept
+-- separately, as only the poster handlers need them.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS poster_url text NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS movie_posters (
+    movie_id bigint PRIMARY KEY REFERENCES movies ON DELETE CASCADE,
+    key text NOT NULL,
+    content_type text NOT NULL,
+    thumbnail_key text NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
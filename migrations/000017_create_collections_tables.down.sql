@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code = 'collections:write';
+
+DROP TABLE IF EXISTS collection_movies;
+DROP TABLE IF EXISTS collections;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS collections (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS collections_name_idx ON collections (lower(name));
+
+-- Movies are listed in a collection by position, lowest first.
+CREATE TABLE IF NOT EXISTS collection_movies (
+    collection_id bigint NOT NULL REFERENCES collections ON DELETE CASCADE,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    position integer NOT NULL,
+    PRIMARY KEY (collection_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS collection_movies_movie_id_idx ON collection_movies (movie_id);
+
+INSERT INTO permissions (code)
+VALUES
+('collections:write');
+
+-- Curating collections is an editorial task, so grant it to the users who can already edit movies.
+INSERT INTO users_permissions
+SELECT users_permissions.user_id, collections.id
+FROM users_permissions
+INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+CROSS JOIN permissions AS collections
+WHERE permissions.code = 'movies:write' AND collections.code = 'collections:write';
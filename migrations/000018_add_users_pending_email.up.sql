@@ -0,0 +1,2 @@
+-- An address the user has asked to change their email to, held until they confirm it from a token sent there.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email citext;
@@ -0,0 +1,5 @@
+-- Revisions are removed along with their movie when it's purged. Clear out those left behind by earlier purges first.
+DELETE FROM movie_revisions WHERE movie_id NOT IN (SELECT id FROM movies);
+
+ALTER TABLE movie_revisions ADD CONSTRAINT movie_revisions_movie_id_fkey
+    FOREIGN KEY (movie_id) REFERENCES movies ON DELETE CASCADE;
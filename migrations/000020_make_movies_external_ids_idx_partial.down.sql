@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS movies_external_ids_imdb_idx;
+DROP INDEX IF EXISTS movies_external_ids_tmdb_idx;
+DROP INDEX IF EXISTS movies_external_ids_eidr_idx;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_imdb_idx ON movies ((external_ids->>'imdb'));
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_tmdb_idx ON movies ((external_ids->>'tmdb'));
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_eidr_idx ON movies ((external_ids->>'eidr'));
@@ -0,0 +1,8 @@
+-- Soft deleted movies give up their external ids, so the ids can be reused until the movie is restored.
+DROP INDEX IF EXISTS movies_external_ids_imdb_idx;
+DROP INDEX IF EXISTS movies_external_ids_tmdb_idx;
+DROP INDEX IF EXISTS movies_external_ids_eidr_idx;
+
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_imdb_idx ON movies ((external_ids->>'imdb')) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_tmdb_idx ON movies ((external_ids->>'tmdb')) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_ids_eidr_idx ON movies ((external_ids->>'eidr')) WHERE deleted_at IS NULL;
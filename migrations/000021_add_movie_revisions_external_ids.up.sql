@@ -0,0 +1,7 @@
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS external_ids jsonb NOT NULL DEFAULT '{}';
+
+-- Revisions recorded before external ids were snapshotted take the movie's current ids, so restoring one of them
+-- leaves the ids as they are.
+UPDATE movie_revisions SET external_ids = movies.external_ids
+FROM movies
+WHERE movies.id = movie_revisions.movie_id;